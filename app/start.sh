@@ -1,4 +1,14 @@
 #!/bin/sh
 
-reloader --origin http://localhost:$PKGSITE_PORT --public http://0.0.0.0:$PROXY_PORT --snippet $APPDIR/websocket.html &
-goat -c $APPDIR/goat.yml -i 500
+FILTER=""
+if [ -n "$MODULES_FILTER" ]; then
+	FILTER="--modules-filter $MODULES_FILTER"
+fi
+
+INDEX=""
+if [ -n "$INDEX_PATH" ]; then
+	INDEX="--index $INDEX_PATH"
+fi
+
+exec reloader --origin http://localhost:$PKGSITE_PORT --public http://0.0.0.0:$PROXY_PORT \
+	--watch $GOSRC --pkgsite pkgsite --pkgsite-port $PKGSITE_PORT --modules $GOSRC $FILTER $INDEX
@@ -2,71 +2,263 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/mauroalderete/pkgsite-local-live/config"
 	"github.com/mauroalderete/pkgsite-local-live/server"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	rootCmd = &cobra.Command{
 		Use:   "reloader",
 		Short: "Create a proxy webserver instance that inject a reloader script based websocket",
-		Long: `reloader is a proxy webserver that replicate a server endpoint and 
+		Long: `reloader is a proxy webserver that replicate a server endpoint and
 	inject him a javascript snippet on all html requested.
 	It allows that the clients listens a websocket server will expected for a reload signal
-	to refresh the webpage loaded in the browsers.`,
+	to refresh the webpage loaded in the browsers.
+
+	The options can be loaded from a YAML or TOML file passed with --config,
+	and overwritten by RELOADER_* environment variables and by the flags, in that order.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 
-			srv, err := server.New(func(c server.Configurator) error {
-				err := c.Origin(origin)
-				if err != nil {
-					return fmt.Errorf("failed to configure the origin address to the server instance:%v", err)
-				}
-				err = c.Public(public)
-				if err != nil {
-					return fmt.Errorf("failed to configure the public address to the server instance:%v", err)
-				}
-				err = c.ReloadSnippet(snippetFilepath)
+			cnf, err := load(cmd)
+			if err != nil {
+				return err
+			}
+
+			srv, err := server.New(configure(cnf))
+			if err != nil {
+				log.Fatalf("Something went wrong to configure the server: %v", err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			failed := make(chan error, 1)
+			go func() {
+				log.Printf("Start server at %s to serve the origin %s\n", cnf.Public, cnf.Origin)
+				failed <- srv.Run()
+			}()
+
+			select {
+			case err := <-failed:
 				if err != nil {
-					return fmt.Errorf("failed to configure the reload snippet path to the server instance:%v", err)
+					log.Fatalf("Something went wrong while proxy was running: %v", err)
 				}
 				return nil
-			})
-			if err != nil {
-				log.Fatalf("Something went wrong to configure the server: %v", err)
+			case <-ctx.Done():
 			}
 
-			log.Printf("Start server at %s to serve the origin %s\n", origin, public)
-			err = srv.Run()
+			// a second signal kills the process as usual
+			stop()
+			log.Printf("Shutting down the server\n")
+
+			shutdown, cancel := context.WithTimeout(context.Background(), time.Duration(cnf.ShutdownTimeout))
+			defer cancel()
+
+			err = srv.Shutdown(shutdown)
 			if err != nil {
-				log.Fatalf("Something went wrong while proxy was running: %v", err)
+				log.Printf("Something went wrong while the server was shutting down: %v", err)
 			}
 
+			// waits Run returns after the listener is closed
+			<-failed
+
 			return nil
 		},
 	}
 
-	// store the url to the backend endpoint passed by arguments
-	origin string
-
-	// store the url to the frontend public passed by arguments
-	public string
-
-	// store the path to the file that contains the snippet to inject by livereload.livereaload interceptor.
-	snippetFilepath string
+	// store the path to the config file passed by arguments
+	configPath string
 )
 
 func Execute() error {
 	return rootCmd.Execute()
 }
 
+// load builds the configuration layering the config file, the environment variables and the flags set.
+func load(cmd *cobra.Command) (*config.Config, error) {
+	cnf := config.Default()
+
+	path := configPath
+	if !cmd.Flags().Changed("config") {
+		path = os.Getenv(config.EnvName("config"))
+	}
+
+	if path != "" {
+		err := cnf.Load(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := cnf.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			err = cnf.SetList(f.Name, slice.GetSlice())
+			return
+		}
+
+		err = cnf.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply flags: %v", err)
+	}
+
+	err = cnf.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	return cnf, nil
+}
+
+// configure returns the option callback that applies the configuration to the server instance.
+func configure(cnf *config.Config) func(server.Configurator) error {
+	return func(c server.Configurator) error {
+		err := c.Origin(cnf.Origin)
+		if err != nil {
+			return fmt.Errorf("failed to configure the origin address to the server instance:%v", err)
+		}
+		err = c.Public(cnf.Public)
+		if err != nil {
+			return fmt.Errorf("failed to configure the public address to the server instance:%v", err)
+		}
+		if cnf.Snippet != "" {
+			err = c.ReloadSnippet(cnf.Snippet)
+			if err != nil {
+				return fmt.Errorf("failed to configure the reload snippet path to the server instance:%v", err)
+			}
+		}
+		err = c.InjectionPoint(cnf.Inject)
+		if err != nil {
+			return fmt.Errorf("failed to configure the injection point to the server instance:%v", err)
+		}
+		err = c.CSP(cnf.CSP)
+		if err != nil {
+			return fmt.Errorf("failed to configure the csp source to the server instance:%v", err)
+		}
+		err = c.Dev(cnf.Dev)
+		if err != nil {
+			return fmt.Errorf("failed to configure the development mode to the server instance:%v", err)
+		}
+		err = c.WaitOrigin(time.Duration(cnf.WaitOrigin))
+		if err != nil {
+			return fmt.Errorf("failed to configure the wait origin timeout to the server instance:%v", err)
+		}
+		err = c.PingInterval(time.Duration(cnf.Websocket.PingInterval))
+		if err != nil {
+			return fmt.Errorf("failed to configure the ping interval to the server instance:%v", err)
+		}
+		err = c.PongWait(time.Duration(cnf.Websocket.PongWait))
+		if err != nil {
+			return fmt.Errorf("failed to configure the pong wait to the server instance:%v", err)
+		}
+		err = c.ReconnectInterval(time.Duration(cnf.Websocket.ReconnectInterval))
+		if err != nil {
+			return fmt.Errorf("failed to configure the reconnect interval to the server instance:%v", err)
+		}
+		if len(cnf.Websocket.Origins) > 0 {
+			err = c.WebsocketOrigins(cnf.Websocket.Origins)
+			if err != nil {
+				return fmt.Errorf("failed to configure the websocket origins to the server instance:%v", err)
+			}
+		}
+		if cnf.Pkgsite.Binary != "" {
+			err = c.Pkgsite(cnf.Pkgsite.Binary)
+			if err != nil {
+				return fmt.Errorf("failed to configure the pkgsite binary to the server instance:%v", err)
+			}
+			err = c.PkgsiteArgs(cnf.Pkgsite.Args)
+			if err != nil {
+				return fmt.Errorf("failed to configure the pkgsite arguments to the server instance:%v", err)
+			}
+			err = c.PkgsitePort(cnf.Pkgsite.Port)
+			if err != nil {
+				return fmt.Errorf("failed to configure the pkgsite port to the server instance:%v", err)
+			}
+		}
+		if cnf.Modules.Root != "" {
+			err = c.Modules(cnf.Modules.Root)
+			if err != nil {
+				return fmt.Errorf("failed to configure the modules root to the server instance:%v", err)
+			}
+			if cnf.Modules.Filter != "" {
+				err = c.ModulesFilter(cnf.Modules.Filter)
+				if err != nil {
+					return fmt.Errorf("failed to configure the modules filter to the server instance:%v", err)
+				}
+			}
+			if cnf.Index != "" {
+				err = c.Index(cnf.Index)
+				if err != nil {
+					return fmt.Errorf("failed to configure the index path to the server instance:%v", err)
+				}
+			}
+		}
+		if cnf.Watch.Path == "" {
+			return nil
+		}
+		err = c.Watch(cnf.Watch.Path)
+		if err != nil {
+			return fmt.Errorf("failed to configure the watch path to the server instance:%v", err)
+		}
+		err = c.WatchExtensions(cnf.Watch.Extensions)
+		if err != nil {
+			return fmt.Errorf("failed to configure the watch extensions to the server instance:%v", err)
+		}
+		err = c.WatchPolling(cnf.Watch.Polling)
+		if err != nil {
+			return fmt.Errorf("failed to configure the watch polling to the server instance:%v", err)
+		}
+		err = c.WatchInterval(time.Duration(cnf.Watch.Interval))
+		if err != nil {
+			return fmt.Errorf("failed to configure the watch interval to the server instance:%v", err)
+		}
+		return nil
+	}
+}
+
 func init() {
-	rootCmd.Flags().StringVarP(&origin, "origin", "o", "", "URL to endpoint that the proxy must be replicate.")
-	rootCmd.Flags().StringVarP(&public, "public", "p", "", "URL to expose origin modified.")
-	rootCmd.Flags().StringVarP(&snippetFilepath, "snippet", "s", "", "filepath that contains the html snippet to inject in all html page requested by clients.")
-	rootCmd.MarkFlagRequired("origin")
-	rootCmd.MarkFlagRequired("public")
-	rootCmd.MarkFlagRequired("snippet")
+	defaults := config.Default()
+
+	rootCmd.Flags().StringVarP(&configPath, "config", "c", "", "YAML or TOML file with the options. It can be set with "+config.EnvName("config")+" too.")
+	rootCmd.Flags().StringP("origin", "o", defaults.Origin, "URL to endpoint that the proxy must be replicate.")
+	rootCmd.Flags().StringP("public", "p", defaults.Public, "URL to expose origin modified.")
+	rootCmd.Flags().StringP("snippet", "s", defaults.Snippet, "filepath that contains the html snippet to inject in all html page requested by clients. By default, the client embedded is injected.")
+	rootCmd.Flags().String("csp", defaults.CSP, "how the script of the reload client is allowed by the Content-Security-Policy of the pages: none, nonce or hash.")
+	rootCmd.Flags().Bool("dev", defaults.Dev, "development mode, the pages where the reload client is injected are sent with Cache-Control: no-store so the browsers never cache them.")
+	rootCmd.Flags().String("inject", defaults.Inject, "where the snippet is injected in the html pages, body to the end of the body or head to the end of the head.")
+	rootCmd.Flags().Duration("wait-origin", time.Duration(defaults.WaitOrigin), "maximum time to wait the origin responds successfully before sending the reload signal. Zero disables the wait.")
+	rootCmd.Flags().StringP("watch", "w", defaults.Watch.Path, "directory to watch to send the reload signal when any file changes.")
+	rootCmd.Flags().StringSlice("watch-ext", defaults.Watch.Extensions, "extensions of the files to watch.")
+	rootCmd.Flags().Bool("watch-polling", defaults.Watch.Polling, "walk the watched directory periodically instead of use the native file notifications.")
+	rootCmd.Flags().Duration("watch-interval", time.Duration(defaults.Watch.Interval), "time that the changes are grouped before sending the reload signal.")
+	rootCmd.Flags().String("pkgsite", defaults.Pkgsite.Binary, "path to the pkgsite binary to run and restart when the watched files change.")
+	rootCmd.Flags().StringArray("pkgsite-args", defaults.Pkgsite.Args, "extra argument passed to pkgsite, as the comma separated list of modules. It can be repeated.")
+	rootCmd.Flags().Int("pkgsite-port", defaults.Pkgsite.Port, "port where pkgsite must listen.")
+	rootCmd.Flags().StringP("modules", "m", defaults.Modules.Root, "directory where the modules to load by pkgsite are discovered, including nested modules and go.work workspaces.")
+	rootCmd.Flags().String("modules-filter", defaults.Modules.Filter, "yaml file with the include and exclude rules to select the modules to load.")
+	rootCmd.Flags().Duration("ping-interval", time.Duration(defaults.Websocket.PingInterval), "time between the pings sent to each browser connected by websocket.")
+	rootCmd.Flags().Duration("pong-wait", time.Duration(defaults.Websocket.PongWait), "maximum time to wait the pong of a browser before closing its connection.")
+	rootCmd.Flags().Duration("reconnect-interval", time.Duration(defaults.Websocket.ReconnectInterval), "time that the browsers wait before connecting again when the connection with the server is lost.")
+	rootCmd.Flags().StringSlice("websocket-origins", defaults.Websocket.Origins, "origins allowed to open a websocket, as http://localhost:8080, https://*.example.com, public for the public address, same-host for the same host and port of the request, or * for all. By default, localhost, public and same-host.")
+	rootCmd.Flags().Duration("shutdown-timeout", time.Duration(defaults.ShutdownTimeout), "maximum time to wait the pending requests when the command receives SIGINT or SIGTERM.")
+	rootCmd.Flags().String("index", defaults.Index, "path where a page with the list of modules discovered is served, as \"/\" to replace the pkgsite home.")
 }
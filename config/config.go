@@ -0,0 +1,357 @@
+// Package config loads the options of the reloader command.
+//
+// The options can be stored in a YAML or TOML file, and they can be overwritten
+// by `RELOADER_*` environment variables and by the command flags, in that order.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables that overwrite the options.
+//
+// The name of each variable is the prefix followed by the key of the option in upper case
+// with underscores instead of hyphens, as `RELOADER_WATCH_EXT` for the key `watch-ext`.
+const EnvPrefix = "RELOADER_"
+
+// Duration is a [time.Duration] that is written in the files as a string like `500ms` or `30s`.
+type Duration time.Duration
+
+// UnmarshalText implements [encoding.TextUnmarshaler] interface.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText implements [encoding.TextMarshaler] interface.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Watch groups the options of the watcher.
+type Watch struct {
+	Path       string   `yaml:"path" toml:"path"`
+	Extensions []string `yaml:"extensions" toml:"extensions"`
+	Polling    bool     `yaml:"polling" toml:"polling"`
+	Interval   Duration `yaml:"interval" toml:"interval"`
+}
+
+// Pkgsite groups the options of the supervised pkgsite process.
+type Pkgsite struct {
+	Binary string   `yaml:"binary" toml:"binary"`
+	Args   []string `yaml:"args" toml:"args"`
+	Port   int      `yaml:"port" toml:"port"`
+}
+
+// Modules groups the options of the modules discovery.
+type Modules struct {
+	Root   string `yaml:"root" toml:"root"`
+	Filter string `yaml:"filter" toml:"filter"`
+}
+
+// Websocket groups the options of the websocket connections.
+type Websocket struct {
+	PingInterval Duration `yaml:"pingInterval" toml:"pingInterval"`
+	PongWait     Duration `yaml:"pongWait" toml:"pongWait"`
+
+	// ReconnectInterval is the time that the browsers wait before connecting again when the connection is lost.
+	ReconnectInterval Duration `yaml:"reconnectInterval" toml:"reconnectInterval"`
+
+	// Origins are the patterns of the origins that can open a websocket connection.
+	// If it is empty, the pages served by localhost, by the public address and by the same host of the request are allowed.
+	Origins []string `yaml:"origins" toml:"origins"`
+}
+
+// Config stores all options of the reloader command.
+type Config struct {
+	Origin     string    `yaml:"origin" toml:"origin"`
+	Public     string    `yaml:"public" toml:"public"`
+	Snippet    string    `yaml:"snippet" toml:"snippet"`
+	Inject     string    `yaml:"inject" toml:"inject"`
+	CSP        string    `yaml:"csp" toml:"csp"`
+	Dev        bool      `yaml:"dev" toml:"dev"`
+	WaitOrigin Duration  `yaml:"waitOrigin" toml:"waitOrigin"`
+	Index      string    `yaml:"index" toml:"index"`
+	Watch      Watch     `yaml:"watch" toml:"watch"`
+	Pkgsite    Pkgsite   `yaml:"pkgsite" toml:"pkgsite"`
+	Modules    Modules   `yaml:"modules" toml:"modules"`
+	Websocket  Websocket `yaml:"websocket" toml:"websocket"`
+
+	// ShutdownTimeout is the maximum time to wait the pending requests when the command is stopped.
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+}
+
+// Default returns a [config.Config] with the default values of the options.
+func Default() *Config {
+	return &Config{
+		Inject:          "body",
+		CSP:             "none",
+		ShutdownTimeout: Duration(10 * time.Second),
+		Watch: Watch{
+			Extensions: []string{"go", "md"},
+			Interval:   Duration(500 * time.Millisecond),
+		},
+		Websocket: Websocket{
+			PingInterval:      Duration(30 * time.Second),
+			PongWait:          Duration(60 * time.Second),
+			ReconnectInterval: Duration(2 * time.Second),
+		},
+	}
+}
+
+// option describes how an option is written from a plain value, as the environment variables or the flags.
+type option struct {
+
+	// separator splits the value of the list options. It is empty for the scalar options, and a space splits by any blank.
+	separator string
+
+	// set writes the values into the config.
+	set func(c *Config, values []string) error
+}
+
+// options indexes each option by its key. The keys are the names of the command flags.
+var options = map[string]option{
+	"origin":             {"", setString(func(c *Config) *string { return &c.Origin })},
+	"public":             {"", setString(func(c *Config) *string { return &c.Public })},
+	"snippet":            {"", setString(func(c *Config) *string { return &c.Snippet })},
+	"inject":             {"", setString(func(c *Config) *string { return &c.Inject })},
+	"csp":                {"", setString(func(c *Config) *string { return &c.CSP })},
+	"dev":                {"", setBool(func(c *Config) *bool { return &c.Dev })},
+	"wait-origin":        {"", setDuration(func(c *Config) *Duration { return &c.WaitOrigin })},
+	"index":              {"", setString(func(c *Config) *string { return &c.Index })},
+	"watch":              {"", setString(func(c *Config) *string { return &c.Watch.Path })},
+	"watch-ext":          {",", setList(func(c *Config) *[]string { return &c.Watch.Extensions })},
+	"watch-polling":      {"", setBool(func(c *Config) *bool { return &c.Watch.Polling })},
+	"watch-interval":     {"", setDuration(func(c *Config) *Duration { return &c.Watch.Interval })},
+	"pkgsite":            {"", setString(func(c *Config) *string { return &c.Pkgsite.Binary })},
+	"pkgsite-args":       {" ", setList(func(c *Config) *[]string { return &c.Pkgsite.Args })},
+	"pkgsite-port":       {"", setInt(func(c *Config) *int { return &c.Pkgsite.Port })},
+	"modules":            {"", setString(func(c *Config) *string { return &c.Modules.Root })},
+	"modules-filter":     {"", setString(func(c *Config) *string { return &c.Modules.Filter })},
+	"shutdown-timeout":   {"", setDuration(func(c *Config) *Duration { return &c.ShutdownTimeout })},
+	"ping-interval":      {"", setDuration(func(c *Config) *Duration { return &c.Websocket.PingInterval })},
+	"pong-wait":          {"", setDuration(func(c *Config) *Duration { return &c.Websocket.PongWait })},
+	"reconnect-interval": {"", setDuration(func(c *Config) *Duration { return &c.Websocket.ReconnectInterval })},
+	"websocket-origins":  {",", setList(func(c *Config) *[]string { return &c.Websocket.Origins })},
+}
+
+// Keys returns the keys of all options sorted.
+func Keys() []string {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EnvName returns the name of the environment variable that overwrites the option key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// Set writes a plain value into the option key. The list options are split by their separator.
+func (c *Config) Set(key string, value string) error {
+	opt, ok := options[key]
+	if !ok {
+		return fmt.Errorf("unknown option '%s'", key)
+	}
+
+	values := []string{value}
+	switch opt.separator {
+	case "":
+	case " ":
+		values = strings.Fields(value)
+	default:
+		values = strings.Split(value, opt.separator)
+	}
+
+	return c.SetList(key, values)
+}
+
+// SetList writes a list of values into the option key. The scalar options receive only the last value.
+func (c *Config) SetList(key string, values []string) error {
+	opt, ok := options[key]
+	if !ok {
+		return fmt.Errorf("unknown option '%s'", key)
+	}
+
+	err := opt.set(c, values)
+	if err != nil {
+		return fmt.Errorf("invalid value for '%s': %v", key, err)
+	}
+
+	return nil
+}
+
+// ApplyEnv overwrites the options with the environment variables defined.
+//
+// Receives the function used to look up the variables, as [os.LookupEnv].
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, key := range Keys() {
+		value, ok := lookup(EnvName(key))
+		if !ok {
+			continue
+		}
+
+		err := c.Set(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %v", EnvName(key), err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the required options are set.
+func (c *Config) Validate() error {
+	if len(c.Origin) == 0 {
+		return fmt.Errorf("origin is required")
+	}
+
+	if len(c.Public) == 0 {
+		return fmt.Errorf("public is required")
+	}
+
+	// these options are ignored without the option they depend on, so they are rejected to not be lost silently
+	if len(c.Modules.Root) == 0 {
+		if len(c.Modules.Filter) != 0 {
+			return fmt.Errorf("modules filter requires the modules root, set modules.root or --modules")
+		}
+
+		if len(c.Index) != 0 {
+			return fmt.Errorf("index requires the modules root, set modules.root or --modules")
+		}
+	}
+
+	if len(c.Pkgsite.Binary) == 0 {
+		if len(c.Pkgsite.Args) != 0 {
+			return fmt.Errorf("pkgsite arguments require the pkgsite binary, set pkgsite.binary or --pkgsite")
+		}
+
+		if c.Pkgsite.Port != 0 {
+			return fmt.Errorf("pkgsite port requires the pkgsite binary, set pkgsite.binary or --pkgsite")
+		}
+	}
+
+	if c.Websocket.PingInterval <= 0 || c.Websocket.PingInterval >= c.Websocket.PongWait {
+		return fmt.Errorf("ping interval must be greater than zero and less than pong wait")
+	}
+
+	if c.Websocket.ReconnectInterval <= 0 {
+		return fmt.Errorf("reconnect interval must be greater than zero")
+	}
+
+	return nil
+}
+
+// Load overwrites the options with the content of a file.
+//
+// The files with extension `.toml` are parsed as TOML, any other is parsed as YAML.
+// The unknown fields are rejected to detect typos.
+func (c *Config) Load(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		metadata, err := toml.Decode(string(content), c)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("failed to parse config file %s: unknown field '%s'", path, undecoded[0])
+		}
+
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// setString returns a setter of a string option.
+func setString(field func(*Config) *string) func(*Config, []string) error {
+	return func(c *Config, values []string) error {
+		*field(c) = last(values)
+		return nil
+	}
+}
+
+// setList returns a setter of a list option.
+func setList(field func(*Config) *[]string) func(*Config, []string) error {
+	return func(c *Config, values []string) error {
+		list := make([]string, 0, len(values))
+		for _, v := range values {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				list = append(list, v)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+// setBool returns a setter of a boolean option.
+func setBool(field func(*Config) *bool) func(*Config, []string) error {
+	return func(c *Config, values []string) error {
+		v, err := strconv.ParseBool(last(values))
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+// setInt returns a setter of an integer option.
+func setInt(field func(*Config) *int) func(*Config, []string) error {
+	return func(c *Config, values []string) error {
+		v, err := strconv.Atoi(last(values))
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}
+}
+
+// setDuration returns a setter of a duration option.
+func setDuration(field func(*Config) *Duration) func(*Config, []string) error {
+	return func(c *Config, values []string) error {
+		return field(c).UnmarshalText([]byte(last(values)))
+	}
+}
+
+// last returns the last value of the list, or empty if there aren't values.
+func last(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
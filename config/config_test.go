@@ -0,0 +1,276 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile stores the content in a temporary file with the name passed.
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+
+	t.Run("yaml", func(t *testing.T) {
+		path := writeFile(t, "reloader.yml", `
+origin: http://localhost:3000
+public: http://0.0.0.0:80
+snippet: /app/websocket.html
+inject: head
+csp: nonce
+dev: true
+waitOrigin: 10s
+watch:
+  path: /go/src
+  extensions: [go]
+  interval: 1s
+pkgsite:
+  binary: pkgsite
+  port: 3000
+modules:
+  root: /go/src
+shutdownTimeout: 3s
+websocket:
+  pingInterval: 5s
+  pongWait: 15s
+  reconnectInterval: 500ms
+`)
+		cnf := Default()
+		err := cnf.Load(path)
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		if cnf.Origin != "http://localhost:3000" || cnf.Pkgsite.Port != 3000 || cnf.Modules.Root != "/go/src" || cnf.Inject != "head" || cnf.CSP != "nonce" || !cnf.Dev {
+			t.Errorf("expected the file loaded, got %+v", cnf)
+		}
+
+		if time.Duration(cnf.WaitOrigin) != 10*time.Second || time.Duration(cnf.Watch.Interval) != time.Second {
+			t.Errorf("expected durations loaded, got %v and %v", cnf.WaitOrigin, cnf.Watch.Interval)
+		}
+
+		if time.Duration(cnf.ShutdownTimeout) != 3*time.Second {
+			t.Errorf("expected shutdown timeout 3s, got %v", cnf.ShutdownTimeout)
+		}
+
+		if time.Duration(cnf.Websocket.PingInterval) != 5*time.Second || time.Duration(cnf.Websocket.PongWait) != 15*time.Second ||
+			time.Duration(cnf.Websocket.ReconnectInterval) != 500*time.Millisecond {
+			t.Errorf("expected websocket durations loaded, got %+v", cnf.Websocket)
+		}
+
+		if fmt.Sprint(cnf.Watch.Extensions) != "[go]" {
+			t.Errorf("expected extensions [go], got %v", cnf.Watch.Extensions)
+		}
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		path := writeFile(t, "reloader.toml", `
+origin = "http://localhost:3000"
+waitOrigin = "5s"
+
+[watch]
+path = "/go/src"
+polling = true
+`)
+		cnf := Default()
+		err := cnf.Load(path)
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		if cnf.Origin != "http://localhost:3000" || !cnf.Watch.Polling || time.Duration(cnf.WaitOrigin) != 5*time.Second {
+			t.Errorf("expected the file loaded, got %+v", cnf)
+		}
+
+		if fmt.Sprint(cnf.Watch.Extensions) != "[go md]" {
+			t.Errorf("expected the default extensions kept, got %v", cnf.Watch.Extensions)
+		}
+	})
+
+	cases := map[string]string{
+		"unknown yaml field": "orign: http://localhost:3000\n",
+		"wrong duration":     "waitOrigin: ten\n",
+	}
+
+	for n, content := range cases {
+		t.Run(n, func(t *testing.T) {
+			err := Default().Load(writeFile(t, "reloader.yaml", content))
+			if err == nil {
+				t.Errorf("expected an error, got error nil")
+			}
+		})
+	}
+
+	t.Run("unknown toml field", func(t *testing.T) {
+		err := Default().Load(writeFile(t, "reloader.toml", "orign = \"http://localhost:3000\"\n"))
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := Default().Load(filepath.Join(t.TempDir(), "missing.yml"))
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"RELOADER_ORIGIN":            "http://localhost:4000",
+		"RELOADER_WATCH_EXT":         "go, md,tmpl",
+		"RELOADER_WATCH_POLLING":     "true",
+		"RELOADER_PKGSITE_PORT":      "4000",
+		"RELOADER_PKGSITE_ARGS":      "-dev  /go/src/a,/go/src/b",
+		"RELOADER_WATCH_INTERVAL":    "2s",
+		"RELOADER_SHUTDOWN_TIMEOUT":  "1m",
+		"RELOADER_WEBSOCKET_ORIGINS": "public, https://*.example.com",
+	}
+
+	cnf := Default()
+	err := cnf.ApplyEnv(func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	if cnf.Origin != "http://localhost:4000" || !cnf.Watch.Polling || cnf.Pkgsite.Port != 4000 {
+		t.Errorf("expected the environment applied, got %+v", cnf)
+	}
+
+	if fmt.Sprint(cnf.Watch.Extensions) != "[go md tmpl]" {
+		t.Errorf("expected extensions [go md tmpl], got %v", cnf.Watch.Extensions)
+	}
+
+	if time.Duration(cnf.ShutdownTimeout) != time.Minute {
+		t.Errorf("expected shutdown timeout 1m, got %v", cnf.ShutdownTimeout)
+	}
+
+	if fmt.Sprint(cnf.Websocket.Origins) != "[public https://*.example.com]" {
+		t.Errorf("expected origins [public https://*.example.com], got %v", cnf.Websocket.Origins)
+	}
+
+	if fmt.Sprint(cnf.Pkgsite.Args) != "[-dev /go/src/a,/go/src/b]" {
+		t.Errorf("expected args split by blanks, got %v", cnf.Pkgsite.Args)
+	}
+
+	t.Run("wrong value", func(t *testing.T) {
+		err := Default().ApplyEnv(func(name string) (string, bool) {
+			return "not a number", name == "RELOADER_PKGSITE_PORT"
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+func TestSet(t *testing.T) {
+	cnf := Default()
+
+	err := cnf.Set("unknown", "value")
+	if err == nil {
+		t.Errorf("expected an error, got error nil")
+	}
+
+	err = cnf.SetList("pkgsite-args", []string{"/go/src/a,/go/src/b"})
+	if err != nil {
+		t.Errorf("expected error nil, got '%v'", err)
+	}
+
+	if len(cnf.Pkgsite.Args) != 1 {
+		t.Errorf("expected one argument, got %v", cnf.Pkgsite.Args)
+	}
+
+	for _, key := range Keys() {
+		if _, ok := options[key]; !ok {
+			t.Errorf("expected key %s indexed", key)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cnf := Default()
+
+	err := cnf.Validate()
+	if err == nil {
+		t.Errorf("expected an error, got error nil")
+	}
+
+	cnf.Origin = "http://localhost:3000"
+	cnf.Public = "http://0.0.0.0:80"
+
+	err = cnf.Validate()
+	if err != nil {
+		t.Errorf("expected error nil, got '%v'", err)
+	}
+
+	cnf.Websocket.PingInterval = cnf.Websocket.PongWait
+	err = cnf.Validate()
+	if err == nil {
+		t.Errorf("expected an error, got error nil")
+	}
+
+	cnf = Default()
+	cnf.Origin = "http://localhost:3000"
+	cnf.Public = "http://0.0.0.0:80"
+	cnf.Websocket.ReconnectInterval = 0
+	err = cnf.Validate()
+	if err == nil {
+		t.Errorf("expected an error, got error nil")
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	cases := map[string]struct {
+		set   func(c *Config)
+		valid bool
+	}{
+		"filter without root": {func(c *Config) { c.Modules.Filter = "/app/modules.yml" }, false},
+		"index without root":  {func(c *Config) { c.Index = "/" }, false},
+		"index with root": {func(c *Config) {
+			c.Index = "/"
+			c.Modules.Root = "/go/src"
+		}, true},
+		"args without binary": {func(c *Config) { c.Pkgsite.Args = []string{"-dev"} }, false},
+		"port without binary": {func(c *Config) { c.Pkgsite.Port = 3000 }, false},
+		"port with binary": {func(c *Config) {
+			c.Pkgsite.Port = 3000
+			c.Pkgsite.Binary = "pkgsite"
+		}, true},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			cnf := Default()
+			cnf.Origin = "http://localhost:3000"
+			cnf.Public = "http://0.0.0.0:80"
+			tc.set(cnf)
+
+			err := cnf.Validate()
+			if (err == nil) != tc.valid {
+				t.Errorf("expected valid %v, got error '%v'", tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	expected := "RELOADER_MODULES_FILTER"
+	if EnvName("modules-filter") != expected {
+		t.Errorf("expected %s, got %s", expected, EnvName("modules-filter"))
+	}
+}
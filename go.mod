@@ -3,12 +3,15 @@ module github.com/mauroalderete/pkgsite-local-live
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/andybalholm/brotli v1.0.5
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/websocket v1.5.0
 	github.com/spf13/cobra v1.5.0
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/mod v0.8.0
+	golang.org/x/net v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/inconshreveable/mousetrap v1.0.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
-)
+require github.com/inconshreveable/mousetrap v1.0.0 // indirect
@@ -0,0 +1,280 @@
+// Package index renders an HTML page that lists the modules loaded by pkgsite
+// to allow jumping straight to their documentation.
+package index
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mauroalderete/pkgsite-local-live/modules"
+)
+
+// Source defines a function that returns the modules to list.
+type Source func() ([]modules.Module, error)
+
+// entry is a module with the data rendered by the page.
+type entry struct {
+	Path         string
+	Dir          string
+	LastModified time.Time
+	Link         string
+}
+
+// page is the data passed to the template.
+type page struct {
+	Title   string
+	Entries []entry
+	Error   string
+}
+
+// pageTemplate is the HTML of the index.
+var pageTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>{{.Title}}</title>
+	<style>
+		body { font-family: sans-serif; margin: 2rem auto; max-width: 64rem; color: #202224; }
+		table { border-collapse: collapse; width: 100%; }
+		th, td { text-align: left; padding: .5rem; border-bottom: 1px solid #dadce0; }
+		td.dir { color: #5f6368; font-family: monospace; }
+		.error { color: #c5221f; }
+	</style>
+</head>
+<body>
+	<h1>{{.Title}}</h1>
+	{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+	{{if .Entries}}
+	<table>
+		<thead><tr><th>Module</th><th>Directory</th><th>Last modified</th></tr></thead>
+		<tbody>
+		{{range .Entries}}
+			<tr>
+				<td><a href="{{.Link}}">{{.Path}}</a></td>
+				<td class="dir">{{.Dir}}</td>
+				<td>{{if .LastModified.IsZero}}-{{else}}{{.LastModified.Format "2006-01-02 15:04:05"}}{{end}}</td>
+			</tr>
+		{{end}}
+		</tbody>
+	</table>
+	{{else if not .Error}}
+	<p>There are not modules loaded.</p>
+	{{end}}
+</body>
+</html>
+`))
+
+// Index implements [http.Handler] to serve the page with the modules list.
+//
+// The page is computed once and served from a cache, because the last modification of each module
+// requires walking its tree. It must be computed again by [index.Index.Refresh] or [index.Index.Update]
+// when the modules are discovered again or their files change.
+type Index struct {
+
+	// source returns the modules to list when the page isn't computed yet.
+	source Source
+
+	// entries are the modules listed by the page computed, nil if it isn't computed yet.
+	entries []entry
+	mutex   sync.RWMutex
+
+	// title is the heading of the page.
+	title string
+
+	// prefix is prepended to the module path to build the link to its documentation.
+	prefix string
+}
+
+// ServeHTTP implements [http.Handler] interface.
+//
+// Serves the page computed, or computes it from the source if it isn't computed yet.
+func (i *Index) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := page{Title: i.title}
+
+	i.mutex.RLock()
+	data.Entries = i.entries
+	i.mutex.RUnlock()
+
+	if data.Entries == nil {
+		err := i.Refresh()
+		if err != nil {
+			data.Error = err.Error()
+		}
+
+		i.mutex.RLock()
+		data.Entries = i.entries
+		i.mutex.RUnlock()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err := pageTemplate.Execute(w, data)
+	if err != nil {
+		log.Printf("failed to render the index: %v", err)
+	}
+}
+
+// Refresh computes the page again with the modules returned by the source.
+//
+// If the source fails, the page is computed again in the next request.
+func (i *Index) Refresh() error {
+	found, err := i.source()
+	if err != nil {
+		log.Printf("failed to list the modules of the index: %v", err)
+		return err
+	}
+
+	i.Update(found)
+	return nil
+}
+
+// Update computes the page again with the modules passed, as the ones found by other discovery.
+func (i *Index) Update(found []modules.Module) {
+	entries := make([]entry, 0, len(found))
+
+	for _, module := range found {
+		entries = append(entries, entry{
+			Path:         module.Path,
+			Dir:          module.Dir,
+			LastModified: lastModified(module.Dir),
+			Link:         i.prefix + module.Path,
+		})
+	}
+
+	i.mutex.Lock()
+	i.entries = entries
+	i.mutex.Unlock()
+}
+
+// lastModified returns the latest modification time of the files of a module.
+//
+// The hidden folders, `vendor` and `testdata` are skipped. Returns the zero time if the dir can't be walked.
+func lastModified(dir string) time.Time {
+	var latest time.Time
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+
+	return latest
+}
+
+// Configurer defines the configurable options to build a new instance of [index.Index].
+type Configurer interface {
+
+	// Source sets the function that returns the modules to list.
+	Source(source Source) error
+
+	// Title sets the heading of the page.
+	Title(title string) error
+
+	// LinkPrefix sets the prefix prepended to the module path to build the link to its documentation.
+	LinkPrefix(prefix string) error
+}
+
+// configurer implements the [index.Configurer] interface.
+type configurer struct {
+	pool []func(*Index) error
+}
+
+// Source implements [index.Configurer.Source] method.
+func (c *configurer) Source(source Source) error {
+
+	if source == nil {
+		return fmt.Errorf("source cannot be nil")
+	}
+
+	c.pool = append(c.pool, func(i *Index) error {
+		i.source = source
+		return nil
+	})
+
+	return nil
+}
+
+// Title implements [index.Configurer.Title] method.
+func (c *configurer) Title(title string) error {
+
+	if len(title) == 0 {
+		return fmt.Errorf("title cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(i *Index) error {
+		i.title = title
+		return nil
+	})
+
+	return nil
+}
+
+// LinkPrefix implements [index.Configurer.LinkPrefix] method.
+func (c *configurer) LinkPrefix(prefix string) error {
+
+	c.pool = append(c.pool, func(i *Index) error {
+		i.prefix = prefix
+		return nil
+	})
+
+	return nil
+}
+
+// New returns a new [index.Index] instance configured.
+//
+// Receives a list of options callback with the configurations to apply.
+// By default, the links point to the root of the same host, as pkgsite serves the modules.
+func New(options ...func(Configurer) error) (*Index, error) {
+
+	configurer := &configurer{}
+
+	for _, option := range options {
+		err := option(configurer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load options: %v", err)
+		}
+	}
+
+	index := &Index{
+		title:  "Modules",
+		prefix: "/",
+	}
+
+	for _, config := range configurer.pool {
+		err := config(index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply options: %v", err)
+		}
+	}
+
+	if index.source == nil {
+		return nil, fmt.Errorf("source is required")
+	}
+
+	return index, nil
+}
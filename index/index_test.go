@@ -0,0 +1,126 @@
+package index
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauroalderete/pkgsite-local-live/modules"
+)
+
+func TestNew(t *testing.T) {
+
+	t.Run("without source", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("title empty", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.Title("")
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+func TestServeHTTP(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/a\n"), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write go.mod: %v", err)
+	}
+
+	modified := time.Date(2022, 9, 1, 10, 30, 0, 0, time.Local)
+	err = os.Chtimes(filepath.Join(dir, "go.mod"), modified, modified)
+	if err != nil {
+		t.Fatalf("failed to change times: %v", err)
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		index, err := New(func(c Configurer) error {
+			return c.Source(func() ([]modules.Module, error) {
+				return []modules.Module{{Path: "example.com/a", Dir: dir}}, nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("failed to instance the index: %v", err)
+		}
+
+		response := httptest.NewRecorder()
+		index.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		body := response.Body.String()
+		expected := []string{`<a href="/example.com/a">example.com/a</a>`, dir, "2022-09-01 10:30:00"}
+		for _, e := range expected {
+			if !strings.Contains(body, e) {
+				t.Errorf("expected the page contains '%s', got '%s'", e, body)
+			}
+		}
+
+		if !strings.HasPrefix(response.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("expected html content type, got '%s'", response.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("source failed", func(t *testing.T) {
+		index, err := New(func(c Configurer) error {
+			return c.Source(func() ([]modules.Module, error) {
+				return nil, fmt.Errorf("some was wrong")
+			})
+		})
+		if err != nil {
+			t.Fatalf("failed to instance the index: %v", err)
+		}
+
+		response := httptest.NewRecorder()
+		index.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if !strings.Contains(response.Body.String(), "some was wrong") {
+			t.Errorf("expected the page shows the error, got '%s'", response.Body.String())
+		}
+	})
+	t.Run("cached", func(t *testing.T) {
+		calls := 0
+		index, err := New(func(c Configurer) error {
+			return c.Source(func() ([]modules.Module, error) {
+				calls++
+				return []modules.Module{{Path: "example.com/a", Dir: dir}}, nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("failed to instance the index: %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			index.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+
+		if calls != 1 {
+			t.Errorf("expected the source called once, got %d calls", calls)
+		}
+
+		index.Update([]modules.Module{{Path: "example.com/b", Dir: dir}})
+
+		response := httptest.NewRecorder()
+		index.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if !strings.Contains(response.Body.String(), `<a href="/example.com/b">example.com/b</a>`) {
+			t.Errorf("expected the page updated, got '%s'", response.Body.String())
+		}
+
+		if calls != 1 {
+			t.Errorf("expected the source called once, got %d calls", calls)
+		}
+	})
+}
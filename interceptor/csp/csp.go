@@ -0,0 +1,220 @@
+// Package csp amends the Content-Security-Policy of the html pages modified by other interceptor,
+// so the browsers allow the scripts and connections that it added.
+package csp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mauroalderete/pkgsite-local-live/interceptor"
+)
+
+// CSP implements [interceptor.Interceptor] interface.
+//
+// It adds the script and the endpoints of the reloader to the `script-src` and `connect-src` directives
+// of the responses marked by other interceptor, as livereload.
+type CSP struct {
+	rules     []interceptor.InterceptorRuler
+	mark      string
+	script    string
+	websocket string
+	events    string
+}
+
+// Rules implements [interceptor.Interceptor.Rules] method.
+// Returns a list of [interceptor.InterceptorRuler] that accepts only the responses with the mark configured.
+func (c *CSP) Rules() []interceptor.InterceptorRuler {
+	return c.rules
+}
+
+// Handler implements [interceptor.Interceptor.Handler] method.
+// Returns a interceptor.InterceptorHandler callback.
+//
+// The method returned adds the script to the `script-src` directive, and the websocket and events endpoints
+// to the `connect-src` directive, of the Content-Security-Policy headers of the response.
+//
+// The sources are the urls of the endpoints in the address that the browser used to request the page,
+// known by the X-Forwarded-Host and X-Forwarded-Proto headers of the request. Without them, `'self'` is allowed.
+// The script isn't added to the policies with `'strict-dynamic'`, that only allow the scripts by nonce or hash.
+func (c *CSP) Handler() interceptor.InterceptorHandler {
+	return func(r *http.Response) error {
+		scheme, host := address(r.Request)
+
+		// with 'strict-dynamic' the browsers ignore the urls, the script is allowed by the nonce of livereload
+		if c.script != "" && !StrictDynamic(r.Header, "script-src") {
+			Allow(r.Header, "script-src", source(scheme, host, c.script))
+		}
+
+		connect := []string{}
+		if c.websocket != "" {
+			websocket := "ws"
+			if scheme == "https" {
+				websocket = "wss"
+			}
+			connect = append(connect, source(websocket, host, c.websocket))
+		}
+		if c.events != "" {
+			connect = append(connect, source(scheme, host, c.events))
+		}
+
+		if len(connect) > 0 {
+			Allow(r.Header, "connect-src", connect...)
+		}
+
+		return nil
+	}
+}
+
+// address returns the scheme and the host that the browser used to request the page.
+// The host is empty if it isn't known.
+func address(r *http.Request) (string, string) {
+	if r == nil {
+		return "", ""
+	}
+
+	host := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0])
+	scheme := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]))
+
+	if scheme != "https" {
+		scheme = "http"
+	}
+
+	// the host is written in the policy, so it can't have the separators of the sources and directives
+	if strings.ContainsAny(host, " \t;,'\"") {
+		host = ""
+	}
+
+	return scheme, host
+}
+
+// source returns the source expression that allows the endpoint in the host passed,
+// or `'self'` if the host isn't known.
+func source(scheme string, host string, endpoint string) string {
+	if host == "" {
+		return "'self'"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, host, endpoint)
+}
+
+// Configurer define the configurable options to build a new instance of [csp.CSP].
+type Configurer interface {
+
+	// After sets the mark of the interceptor whose responses must be amended, as it is recorded by [interceptor.Mark].
+	After(mark string) error
+
+	// Script sets the path of the script that must be allowed.
+	Script(path string) error
+
+	// Websocket sets the path of the websocket endpoint that must be allowed.
+	Websocket(path string) error
+
+	// Events sets the path of the Server-Sent Events endpoint that must be allowed.
+	Events(path string) error
+}
+
+// configurer implement the [csp.Configurer] interface.
+//
+// It stores in a pool the callbacks with the configurable options
+// that must be called by the constructor of [csp.CSP] to apply the configurations.
+type configurer struct {
+	pool []func(c *CSP) error
+}
+
+// After implements [csp.Configurer.After] method.
+func (c *configurer) After(mark string) error {
+
+	if len(mark) == 0 {
+		return fmt.Errorf("mark cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(csp *CSP) error {
+		csp.mark = mark
+		return nil
+	})
+
+	return nil
+}
+
+// Script implements [csp.Configurer.Script] method.
+func (c *configurer) Script(path string) error {
+
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("script path must start with /")
+	}
+
+	c.pool = append(c.pool, func(csp *CSP) error {
+		csp.script = path
+		return nil
+	})
+
+	return nil
+}
+
+// Websocket implements [csp.Configurer.Websocket] method.
+func (c *configurer) Websocket(path string) error {
+
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("websocket path must start with /")
+	}
+
+	c.pool = append(c.pool, func(csp *CSP) error {
+		csp.websocket = path
+		return nil
+	})
+
+	return nil
+}
+
+// Events implements [csp.Configurer.Events] method.
+func (c *configurer) Events(path string) error {
+
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("events path must start with /")
+	}
+
+	c.pool = append(c.pool, func(csp *CSP) error {
+		csp.events = path
+		return nil
+	})
+
+	return nil
+}
+
+// New returns a [csp.CSP] instance that implements the [interceptor.Interceptor] interface.
+//
+// Receive a list of configurations callback to apply the options. The mark is required,
+// so only the responses modified by that interceptor are amended.
+func New(options ...func(Configurer) error) (interceptor.Interceptor, error) {
+
+	csp := &CSP{}
+
+	configurer := &configurer{}
+
+	for _, option := range options {
+		err := option(configurer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the configuration: %v", err)
+		}
+	}
+
+	for _, config := range configurer.pool {
+		err := config(csp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply the configuration: %v", err)
+		}
+	}
+
+	if len(csp.mark) == 0 {
+		return nil, fmt.Errorf("a mark is required")
+	}
+
+	csp.rules = []interceptor.InterceptorRuler{
+		func(r *http.Response) bool {
+			return interceptor.Marked(r, csp.mark)
+		},
+	}
+
+	return csp, nil
+}
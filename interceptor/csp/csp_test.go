@@ -0,0 +1,163 @@
+package csp
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mauroalderete/pkgsite-local-live/interceptor"
+)
+
+// newCSP returns a csp interceptor of the responses marked by livereload.
+func newCSP(t *testing.T) interceptor.Interceptor {
+	t.Helper()
+
+	i, err := New(func(c Configurer) error {
+		err := c.After("livereload")
+		if err != nil {
+			return err
+		}
+		err = c.Script("/__reloader/client.js")
+		if err != nil {
+			return err
+		}
+		err = c.Websocket("/ws")
+		if err != nil {
+			return err
+		}
+		return c.Events("/ws/events")
+	})
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	return i
+}
+
+// run executes the interceptor like the reverse proxy, only if the response passes its rules.
+func run(t *testing.T, i interceptor.Interceptor, r *http.Response) {
+	t.Helper()
+
+	for _, rule := range i.Rules() {
+		if !rule(r) {
+			return
+		}
+	}
+
+	err := i.Handler()(r)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+}
+
+func TestCSP(t *testing.T) {
+	cases := map[string]struct {
+		marked    bool
+		forwarded map[string]string
+		policy    string
+		expected  string
+	}{
+		"unmarked": {
+			marked:   false,
+			policy:   "script-src 'self'",
+			expected: "script-src 'self'",
+		},
+		"http": {
+			marked:    true,
+			forwarded: map[string]string{"X-Forwarded-Host": "localhost:8080", "X-Forwarded-Proto": "http"},
+			policy:    "script-src 'none'; connect-src 'self'",
+			expected:  "script-src http://localhost:8080/__reloader/client.js; connect-src 'self' ws://localhost:8080/ws http://localhost:8080/ws/events",
+		},
+		"https": {
+			marked:    true,
+			forwarded: map[string]string{"X-Forwarded-Host": "docs.example.com", "X-Forwarded-Proto": "https"},
+			policy:    "default-src 'self'",
+			expected:  "default-src 'self'; script-src 'self' https://docs.example.com/__reloader/client.js; connect-src 'self' wss://docs.example.com/ws https://docs.example.com/ws/events",
+		},
+		"unknown host": {
+			marked:   true,
+			policy:   "script-src 'nonce-a'; connect-src 'none'",
+			expected: "script-src 'nonce-a' 'self'; connect-src 'self'",
+		},
+		"invalid host": {
+			marked:    true,
+			forwarded: map[string]string{"X-Forwarded-Host": "evil; script-src *"},
+			policy:    "script-src 'nonce-a'",
+			expected:  "script-src 'nonce-a' 'self'",
+		},
+		"strict-dynamic": {
+			marked:    true,
+			forwarded: map[string]string{"X-Forwarded-Host": "localhost:8080", "X-Forwarded-Proto": "http"},
+			policy:    "script-src 'nonce-a' 'strict-dynamic'; connect-src 'self'",
+			expected:  "script-src 'nonce-a' 'strict-dynamic'; connect-src 'self' ws://localhost:8080/ws http://localhost:8080/ws/events",
+		},
+		"without restrictions": {
+			marked:    true,
+			forwarded: map[string]string{"X-Forwarded-Host": "localhost:8080"},
+			policy:    "img-src *",
+			expected:  "img-src *",
+		},
+	}
+
+	i := newCSP(t)
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			request := &http.Request{Header: http.Header{}}
+			for k, v := range c.forwarded {
+				request.Header.Set(k, v)
+			}
+
+			r := &http.Response{
+				Header:  http.Header{"Content-Security-Policy": []string{c.policy}},
+				Request: request,
+			}
+			if c.marked {
+				interceptor.Mark(r, "livereload")
+			}
+
+			run(t, i, r)
+
+			if got := r.Header.Get("Content-Security-Policy"); got != c.expected {
+				t.Errorf("expected '%s', got '%s'", c.expected, got)
+			}
+		})
+	}
+
+	t.Run("without policy", func(t *testing.T) {
+		r := &http.Response{Header: http.Header{}}
+		interceptor.Mark(r, "livereload")
+
+		run(t, i, r)
+
+		if len(r.Header) != 0 {
+			t.Errorf("expected the header unmodified, got %v", r.Header)
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		option func(c Configurer) error
+		fail   bool
+	}{
+		"without mark":       {func(c Configurer) error { return nil }, true},
+		"empty mark":         {func(c Configurer) error { return c.After("") }, true},
+		"relative script":    {func(c Configurer) error { return c.Script("client.js") }, true},
+		"relative websocket": {func(c Configurer) error { return c.Websocket("ws") }, true},
+		"relative events":    {func(c Configurer) error { return c.Events("events") }, true},
+		"failed option":      {func(c Configurer) error { return fmt.Errorf("some was wrong") }, true},
+		"only mark":          {func(c Configurer) error { return c.After("livereload") }, false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			_, err := New(c.option)
+			if (err != nil) != c.fail {
+				t.Errorf("expected error %v, got '%v'", c.fail, err)
+			}
+		})
+	}
+}
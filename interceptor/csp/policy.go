@@ -0,0 +1,172 @@
+package csp
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Allow adds the sources to the directive of the Content-Security-Policy headers of the response,
+// including the policies only reported.
+//
+// The sources are added to the directive, or to a copy of the `default-src` directive
+// if the policy doesn't have it. The policies without those directives don't restrict the directive, so they aren't modified.
+func Allow(header http.Header, directive string, sources ...string) {
+	for _, name := range policies {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		amended := make([]string, 0, len(values))
+		for _, policy := range values {
+			for _, source := range sources {
+				policy = AddSource(policy, directive, source)
+			}
+			amended = append(amended, policy)
+		}
+
+		header.Del(name)
+		for _, policy := range amended {
+			header.Add(name, policy)
+		}
+	}
+}
+
+// AddSource returns the policy with the source added to the directive.
+//
+// If the policy doesn't have the directive, it is added with the sources of `default-src`.
+// If the policy doesn't have neither, it is returned as is.
+func AddSource(policy string, directive string, source string) string {
+	directives := strings.Split(policy, ";")
+
+	fallback := -1
+	for i, d := range directives {
+		fields := strings.Fields(d)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case strings.ToLower(directive):
+			directives[i] = " " + join(fields, source)
+			return strings.TrimSpace(strings.Join(directives, ";"))
+		case "default-src":
+			fallback = i
+		}
+	}
+
+	if fallback < 0 {
+		return policy
+	}
+
+	fields := strings.Fields(directives[fallback])
+	fields[0] = directive
+
+	return strings.TrimSuffix(strings.TrimSpace(strings.Join(directives, ";")), ";") + "; " + join(fields, source)
+}
+
+// join returns the directive with the source added, and without the `'none'` source, that can't be combined with others.
+func join(fields []string, source string) string {
+	sources := []string{fields[0]}
+	for _, f := range fields[1:] {
+		if strings.EqualFold(f, "'none'") || f == source {
+			continue
+		}
+		sources = append(sources, f)
+	}
+
+	return strings.Join(append(sources, source), " ")
+}
+
+// policies are the headers of the Content-Security-Policy, including the policies only reported.
+var policies = []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"}
+
+// Sources returns the sources of the directive of each Content-Security-Policy header of the response,
+// including the policies only reported, or the sources of `default-src` if a policy doesn't have the directive.
+// The policies without those directives don't restrict the directive, so they aren't returned.
+func Sources(header http.Header, directive string) [][]string {
+	result := [][]string{}
+
+	for _, name := range policies {
+		for _, policy := range header.Values(name) {
+			var fallback []string
+			found := false
+
+			for _, d := range strings.Split(policy, ";") {
+				fields := strings.Fields(d)
+				if len(fields) == 0 {
+					continue
+				}
+
+				switch strings.ToLower(fields[0]) {
+				case strings.ToLower(directive):
+					result = append(result, fields[1:])
+					found = true
+				case "default-src":
+					fallback = fields[1:]
+				}
+
+				if found {
+					break
+				}
+			}
+
+			if !found && fallback != nil {
+				result = append(result, fallback)
+			}
+		}
+	}
+
+	return result
+}
+
+// UnsafeInline returns true if some policy allows the inline scripts of the directive only by `'unsafe-inline'`.
+//
+// As the browsers ignore `'unsafe-inline'` when the directive has a nonce or a hash, adding them to that policy
+// would block the inline scripts of the page.
+func UnsafeInline(header http.Header, directive string) bool {
+	for _, sources := range Sources(header, directive) {
+		inline := false
+		for _, source := range sources {
+			if isNonceOrHash(source) {
+				inline = false
+				break
+			}
+			if strings.EqualFold(source, "'unsafe-inline'") {
+				inline = true
+			}
+		}
+
+		if inline {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StrictDynamic returns true if some policy has `'strict-dynamic'` in the directive.
+//
+// The browsers ignore the hosts and `'self'` of that directive, so only the scripts with a nonce or a hash are allowed.
+func StrictDynamic(header http.Header, directive string) bool {
+	for _, sources := range Sources(header, directive) {
+		for _, source := range sources {
+			if strings.EqualFold(source, "'strict-dynamic'") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isNonceOrHash returns true if the source is a nonce or a hash, as `'nonce-...'` or `'sha256-...'`.
+func isNonceOrHash(source string) bool {
+	source = strings.ToLower(source)
+	for _, prefix := range []string{"'nonce-", "'sha256-", "'sha384-", "'sha512-"} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return false
+}
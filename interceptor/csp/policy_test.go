@@ -0,0 +1,113 @@
+package csp
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAddSource(t *testing.T) {
+	cases := map[string]struct {
+		policy   string
+		expected string
+	}{
+		"script-src":            {"script-src 'self'", "script-src 'self' 'nonce-a'"},
+		"between directives":    {"img-src *; script-src 'self'; style-src 'self'", "img-src *; script-src 'self' 'nonce-a'; style-src 'self'"},
+		"upper case":            {"SCRIPT-SRC 'self'", "SCRIPT-SRC 'self' 'nonce-a'"},
+		"none":                  {"script-src 'none'", "script-src 'nonce-a'"},
+		"already allowed":       {"script-src 'nonce-a' 'self'", "script-src 'self' 'nonce-a'"},
+		"default-src":           {"default-src 'self'; img-src *", "default-src 'self'; img-src *; script-src 'self' 'nonce-a'"},
+		"default-src semicolon": {"default-src 'none';", "default-src 'none'; script-src 'nonce-a'"},
+		"without directives":    {"img-src *", "img-src *"},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			if got := AddSource(c.policy, "script-src", "'nonce-a'"); got != c.expected {
+				t.Errorf("expected '%s', got '%s'", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	header := http.Header{}
+	header.Add("Content-Security-Policy", "script-src 'self'")
+	header.Add("Content-Security-Policy", "img-src *")
+	header.Add("Content-Security-Policy-Report-Only", "default-src 'none'")
+
+	Allow(header, "script-src", "'nonce-a'")
+
+	policies := header.Values("Content-Security-Policy")
+	if len(policies) != 2 || policies[0] != "script-src 'self' 'nonce-a'" || policies[1] != "img-src *" {
+		t.Errorf("expected the policies amended, got %v", policies)
+	}
+
+	if got := header.Get("Content-Security-Policy-Report-Only"); got != "default-src 'none'; script-src 'nonce-a'" {
+		t.Errorf("expected the report only policy amended, got '%s'", got)
+	}
+
+	empty := http.Header{}
+	Allow(empty, "script-src", "'nonce-a'")
+	if len(empty) != 0 {
+		t.Errorf("expected the header without policies unmodified, got %v", empty)
+	}
+}
+
+func TestSources(t *testing.T) {
+	header := http.Header{}
+	header.Add("Content-Security-Policy", "img-src *; script-src 'self' 'nonce-a'")
+	header.Add("Content-Security-Policy", "default-src 'none'")
+	header.Add("Content-Security-Policy", "img-src *")
+	header.Add("Content-Security-Policy-Report-Only", "SCRIPT-SRC 'unsafe-inline'")
+
+	got := fmt.Sprint(Sources(header, "script-src"))
+	if want := "[['self' 'nonce-a'] ['none'] ['unsafe-inline']]"; got != want {
+		t.Errorf("expected sources %s, got %s", want, got)
+	}
+}
+
+func TestUnsafeInline(t *testing.T) {
+	cases := map[string]struct {
+		policy   string
+		expected bool
+	}{
+		"unsafe-inline":              {"script-src 'self' 'unsafe-inline'", true},
+		"default-src":                {"default-src 'unsafe-inline'", true},
+		"with nonce":                 {"script-src 'unsafe-inline' 'nonce-a'", false},
+		"with hash":                  {"script-src 'sha384-a' 'unsafe-inline'", false},
+		"without unsafe-inline":      {"script-src 'self'", false},
+		"unsafe-inline of styles":    {"script-src 'self'; style-src 'unsafe-inline'", false},
+		"without script restriction": {"img-src *", false},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			header := http.Header{"Content-Security-Policy": []string{c.policy}}
+			if got := UnsafeInline(header, "script-src"); got != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestStrictDynamic(t *testing.T) {
+	cases := map[string]struct {
+		policy   string
+		expected bool
+	}{
+		"strict-dynamic":     {"script-src 'nonce-a' 'strict-dynamic'", true},
+		"default-src":        {"default-src 'self' 'STRICT-DYNAMIC'", true},
+		"without":            {"script-src 'self'", false},
+		"in other directive": {"script-src 'self'; style-src 'strict-dynamic'", false},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			header := http.Header{"Content-Security-Policy": []string{c.policy}}
+			if got := StrictDynamic(header, "script-src"); got != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
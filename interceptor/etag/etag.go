@@ -0,0 +1,295 @@
+// Package etag keeps the conditional requests consistent with the html pages modified by other interceptor,
+// so the browsers never reuse a page cached without the modification, or cached by other build of the server.
+package etag
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mauroalderete/pkgsite-local-live/interceptor"
+)
+
+// Mark is the name of the mark recorded on the requests whose validators are translated to the ones of the origin.
+const Mark = "etag"
+
+// separator splits the entity tag of the origin from the build id in the entity tags rewritten.
+const separator = "-live-"
+
+// ETag rewrites the validators of the responses marked by other interceptor, as livereload,
+// and translates them back in the conditional requests sent to the origin.
+//
+// The entity tag of a page modified is the one of the origin followed by the build id,
+// as `W/"origin-live-build"`, and it is always weak because the content isn't the one of the origin.
+// Its Last-Modified is removed, because the page can change without the origin changing.
+//
+// It must be added to the reverse proxy both as [interceptor.RequestInterceptor], with [etag.ETag.Request],
+// and as [interceptor.Interceptor], with [etag.ETag.Response].
+type ETag struct {
+	mark    string
+	buildID string
+	noStore bool
+}
+
+// Request returns the [interceptor.RequestInterceptor] that translates the If-None-Match header of the requests.
+//
+// The entity tags of the current build are sent to the origin as the tag of the origin. The ones of other build are removed,
+// so the origin sends the page again to modify it with the current build. Other entity tags are sent unchanged.
+func (e *ETag) Request() interceptor.RequestInterceptor {
+	return &request{e}
+}
+
+// Response returns the [interceptor.Interceptor] that rewrites the validators of the responses modified,
+// and of the 304 responses of the requests translated.
+func (e *ETag) Response() interceptor.Interceptor {
+	return &response{e}
+}
+
+// tag returns the entity tag of the origin rewritten with the build id, or empty if the tag isn't valid.
+func (e *ETag) tag(origin string) string {
+	opaque := strings.TrimPrefix(strings.TrimSpace(origin), "W/")
+	if len(opaque) < 2 || !strings.HasPrefix(opaque, `"`) || !strings.HasSuffix(opaque, `"`) {
+		return ""
+	}
+
+	return fmt.Sprintf(`W/"%s%s%s"`, opaque[1:len(opaque)-1], separator, e.buildID)
+}
+
+// translate returns the list of entity tags of an If-None-Match header with the tags rewritten translated to the ones of the origin,
+// and if any of them was translated.
+func (e *ETag) translate(header string) (string, bool) {
+	translated := false
+	result := []string{}
+
+	for _, tag := range split(header) {
+		opaque := strings.TrimPrefix(tag, "W/")
+
+		i := strings.LastIndex(opaque, separator)
+		if i < 0 {
+			result = append(result, tag)
+			continue
+		}
+
+		if opaque[i+len(separator):] != e.buildID+`"` {
+			// rewritten by other build, the page cached must be replaced
+			continue
+		}
+
+		translated = true
+		result = append(result, "W/"+opaque[:i]+`"`)
+	}
+
+	return strings.Join(result, ", "), translated
+}
+
+// split returns the entity tags of a list as the If-None-Match header, skipping the commas quoted.
+func split(header string) []string {
+	tags := []string{}
+
+	quoted := false
+	start := 0
+	for i := 0; i < len(header); i++ {
+		switch header[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if quoted {
+				continue
+			}
+			if tag := strings.TrimSpace(header[start:i]); tag != "" {
+				tags = append(tags, tag)
+			}
+			start = i + 1
+		}
+	}
+
+	if tag := strings.TrimSpace(header[start:]); tag != "" {
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// request implements [interceptor.RequestInterceptor] interface for [etag.ETag].
+type request struct {
+	*ETag
+}
+
+// Rules implements [interceptor.RequestInterceptor.Rules] method.
+// Returns a list of [interceptor.RequestInterceptorRuler] that accepts only the conditional requests with If-None-Match header.
+func (r *request) Rules() []interceptor.RequestInterceptorRuler {
+	return []interceptor.RequestInterceptorRuler{
+		func(r *http.Request) bool {
+			return r.Header.Get("If-None-Match") != ""
+		},
+	}
+}
+
+// Handler implements [interceptor.RequestInterceptor.Handler] method.
+// Returns a interceptor.RequestInterceptorHandler callback.
+//
+// The method returned translates the If-None-Match header, removing it if no entity tag remains,
+// and marks the request if any of them was translated, so the 304 response of the origin is rewritten too.
+func (r *request) Handler() interceptor.RequestInterceptorHandler {
+	return func(w http.ResponseWriter, req *http.Request) (bool, error) {
+		header, translated := r.translate(req.Header.Get("If-None-Match"))
+
+		if header == "" {
+			req.Header.Del("If-None-Match")
+		} else {
+			req.Header.Set("If-None-Match", header)
+		}
+
+		if translated {
+			interceptor.MarkRequest(req, Mark)
+		}
+
+		return false, nil
+	}
+}
+
+// response implements [interceptor.Interceptor] interface for [etag.ETag].
+type response struct {
+	*ETag
+}
+
+// Rules implements [interceptor.Interceptor.Rules] method.
+// Returns a list of [interceptor.InterceptorRuler] that accepts the responses with the mark configured,
+// and the 304 responses of the requests translated.
+func (r *response) Rules() []interceptor.InterceptorRuler {
+	return []interceptor.InterceptorRuler{
+		func(res *http.Response) bool {
+			if interceptor.Marked(res, r.mark) {
+				return true
+			}
+			return res.StatusCode == http.StatusNotModified && interceptor.Marked(res, Mark)
+		},
+	}
+}
+
+// Handler implements [interceptor.Interceptor.Handler] method.
+// Returns a interceptor.InterceptorHandler callback.
+//
+// The method returned rewrites the ETag header, removes the Last-Modified header,
+// and forbids the browsers to store the response if it is configured.
+func (r *response) Handler() interceptor.InterceptorHandler {
+	return func(res *http.Response) error {
+		if origin := res.Header.Get("ETag"); origin != "" {
+			if tag := r.tag(origin); tag != "" {
+				res.Header.Set("ETag", tag)
+			} else {
+				res.Header.Del("ETag")
+			}
+		}
+
+		res.Header.Del("Last-Modified")
+
+		if r.noStore {
+			res.Header.Set("Cache-Control", "no-store")
+			res.Header.Del("Expires")
+		}
+
+		return nil
+	}
+}
+
+// Configurer define the configurable options to build a new instance of [etag.ETag].
+type Configurer interface {
+
+	// After sets the mark of the interceptor whose responses must be rewritten, as it is recorded by [interceptor.Mark].
+	After(mark string) error
+
+	// BuildID sets the id of the build of the server, that is appended to the entity tags.
+	BuildID(id string) error
+
+	// NoStore sets if the responses modified are sent with `Cache-Control: no-store`, so the browsers never cache them.
+	NoStore(enabled bool) error
+}
+
+// configurer implement the [etag.Configurer] interface.
+//
+// It stores in a pool the callbacks with the configurable options
+// that must be called by the constructor of [etag.ETag] to apply the configurations.
+type configurer struct {
+	pool []func(e *ETag) error
+}
+
+// After implements [etag.Configurer.After] method.
+func (c *configurer) After(mark string) error {
+
+	if len(mark) == 0 {
+		return fmt.Errorf("mark cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(e *ETag) error {
+		e.mark = mark
+		return nil
+	})
+
+	return nil
+}
+
+// BuildID implements [etag.Configurer.BuildID] method.
+func (c *configurer) BuildID(id string) error {
+
+	if len(id) == 0 {
+		return fmt.Errorf("build id cannot be empty")
+	}
+
+	// the build id is written in the entity tags, so it can't have quotes, spaces or commas
+	if strings.ContainsAny(id, "\" \t,") {
+		return fmt.Errorf("build id '%s' cannot contain quotes, spaces or commas", id)
+	}
+
+	c.pool = append(c.pool, func(e *ETag) error {
+		e.buildID = id
+		return nil
+	})
+
+	return nil
+}
+
+// NoStore implements [etag.Configurer.NoStore] method.
+func (c *configurer) NoStore(enabled bool) error {
+
+	c.pool = append(c.pool, func(e *ETag) error {
+		e.noStore = enabled
+		return nil
+	})
+
+	return nil
+}
+
+// New returns a [etag.ETag] instance with the request and response interceptors.
+//
+// Receive a list of configurations callback to apply the options. The mark and the build id are required.
+func New(options ...func(Configurer) error) (*ETag, error) {
+
+	etag := &ETag{}
+
+	configurer := &configurer{}
+
+	for _, option := range options {
+		err := option(configurer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the configuration: %v", err)
+		}
+	}
+
+	for _, config := range configurer.pool {
+		err := config(etag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply the configuration: %v", err)
+		}
+	}
+
+	if len(etag.mark) == 0 {
+		return nil, fmt.Errorf("a mark is required")
+	}
+
+	if len(etag.buildID) == 0 {
+		return nil, fmt.Errorf("a build id is required")
+	}
+
+	return etag, nil
+}
@@ -0,0 +1,195 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mauroalderete/pkgsite-local-live/interceptor"
+)
+
+// newETag returns an etag interceptor of the responses marked by livereload, in the build `b1`.
+func newETag(t *testing.T, noStore bool) *ETag {
+	t.Helper()
+
+	e, err := New(func(c Configurer) error {
+		err := c.After("livereload")
+		if err != nil {
+			return err
+		}
+		err = c.BuildID("b1")
+		if err != nil {
+			return err
+		}
+		return c.NoStore(noStore)
+	})
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	return e
+}
+
+func TestRequest(t *testing.T) {
+	cases := map[string]struct {
+		header     string
+		expected   string
+		translated bool
+	}{
+		"origin tag":       {`"abc"`, `"abc"`, false},
+		"current build":    {`W/"abc-live-b1"`, `W/"abc"`, true},
+		"other build":      {`W/"abc-live-b0"`, "", false},
+		"list":             {`"x", W/"abc-live-b0", W/"abc-live-b1"`, `"x", W/"abc"`, true},
+		"quoted comma":     {`"a,b-live-b1"`, `W/"a,b"`, true},
+		"any":              {`*`, `*`, false},
+		"build as a start": {`W/"abc-live-b10"`, "", false},
+	}
+
+	e := newETag(t, false)
+	i := e.Request()
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("If-None-Match", c.header)
+
+			for _, rule := range i.Rules() {
+				if !rule(r) {
+					t.Fatalf("expected the rules passed, got rejected")
+				}
+			}
+
+			handled, err := i.Handler()(httptest.NewRecorder(), r)
+			if err != nil {
+				t.Fatalf("expected error nil, got '%v'", err)
+			}
+			if handled {
+				t.Errorf("expected unhandled, got handled")
+			}
+
+			if got := r.Header.Get("If-None-Match"); got != c.expected {
+				t.Errorf("expected If-None-Match '%s', got '%s'", c.expected, got)
+			}
+			if _, ok := r.Header["If-None-Match"]; ok && c.expected == "" {
+				t.Errorf("expected If-None-Match removed, got present")
+			}
+
+			got := interceptor.Marked(&http.Response{Request: r}, Mark)
+			if got != c.translated {
+				t.Errorf("expected marked %v, got %v", c.translated, got)
+			}
+		})
+	}
+
+	t.Run("unconditional", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		for _, rule := range i.Rules() {
+			if rule(r) {
+				t.Errorf("expected the rules rejected, got passed")
+			}
+		}
+	})
+}
+
+func TestResponse(t *testing.T) {
+	cases := map[string]struct {
+		status     int
+		marked     bool
+		translated bool
+		noStore    bool
+		etag       string
+		expected   string
+		cache      string
+		intercept  bool
+	}{
+		"unmarked":            {status: 200, etag: `"abc"`, expected: `"abc"`, cache: "max-age=60"},
+		"marked":              {status: 200, marked: true, etag: `"abc"`, expected: `W/"abc-live-b1"`, cache: "max-age=60", intercept: true},
+		"weak":                {status: 200, marked: true, etag: `W/"abc"`, expected: `W/"abc-live-b1"`, cache: "max-age=60", intercept: true},
+		"invalid":             {status: 200, marked: true, etag: `abc`, expected: "", cache: "max-age=60", intercept: true},
+		"no store":            {status: 200, marked: true, noStore: true, etag: `"abc"`, expected: `W/"abc-live-b1"`, cache: "no-store", intercept: true},
+		"not modified":        {status: 304, translated: true, etag: `"abc"`, expected: `W/"abc-live-b1"`, cache: "max-age=60", intercept: true},
+		"not modified origin": {status: 304, etag: `"abc"`, expected: `"abc"`, cache: "max-age=60"},
+		"ok translated":       {status: 200, translated: true, etag: `"abc"`, expected: `"abc"`, cache: "max-age=60"},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			i := newETag(t, c.noStore).Response()
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.translated {
+				interceptor.MarkRequest(request, Mark)
+			}
+
+			r := &http.Response{StatusCode: c.status, Header: http.Header{}, Request: request}
+			r.Header.Set("ETag", c.etag)
+			r.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			r.Header.Set("Cache-Control", "max-age=60")
+
+			if c.marked {
+				interceptor.Mark(r, "livereload")
+			}
+
+			passed := true
+			for _, rule := range i.Rules() {
+				passed = passed && rule(r)
+			}
+
+			if passed != c.intercept {
+				t.Fatalf("expected intercepted %v, got %v", c.intercept, passed)
+			}
+
+			if passed {
+				err := i.Handler()(r)
+				if err != nil {
+					t.Fatalf("expected error nil, got '%v'", err)
+				}
+			}
+
+			if got := r.Header.Get("ETag"); got != c.expected {
+				t.Errorf("expected ETag '%s', got '%s'", c.expected, got)
+			}
+			if got := r.Header.Get("Cache-Control"); got != c.cache {
+				t.Errorf("expected Cache-Control '%s', got '%s'", c.cache, got)
+			}
+			if got := r.Header.Get("Last-Modified"); (got == "") != c.intercept {
+				t.Errorf("expected Last-Modified removed %v, got '%s'", c.intercept, got)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		option func(Configurer) error
+		valid  bool
+	}{
+		"valid": {func(c Configurer) error {
+			_ = c.After("livereload")
+			return c.BuildID("b1")
+		}, true},
+		"without mark": {func(c Configurer) error {
+			return c.BuildID("b1")
+		}, false},
+		"without build id": {func(c Configurer) error {
+			return c.After("livereload")
+		}, false},
+		"empty mark": {func(c Configurer) error {
+			return c.After("")
+		}, false},
+		"quoted build id": {func(c Configurer) error {
+			_ = c.After("livereload")
+			return c.BuildID(`b"1`)
+		}, false},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			_, err := New(c.option)
+			if (err == nil) != c.valid {
+				t.Errorf("expected valid %v, got error '%v'", c.valid, err)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 // Package interceptor exports a interfaces that defines a interceptor.
 package interceptor
 
-import "net/http"
+import (
+	"io"
+	"net/http"
+)
 
 // InterceptorRuler defines a function that contains the rules to determine if a request must be injected or not.
 //
@@ -24,3 +27,46 @@ type Interceptor interface {
 	// Handler returns a [interceptor.InterceptorHandler] with all operations to modify a content requested.
 	Handler() InterceptorHandler
 }
+
+// InterceptorTransformer defines a function that rewrites the content of a response while it is read,
+// without loading it whole in memory.
+//
+// Receives an *[http.Response] with the headers of the content, and the reader of its body.
+// Returns a reader that produces the content modified.
+type InterceptorTransformer func(*http.Response, io.Reader) io.Reader
+
+// StreamInterceptor is an [interceptor.Interceptor] able to modify the content as it flows to the client.
+//
+// When an interceptor implements it, the transformer is used instead of the handler,
+// and the response is sent without Content-Length because its size isn't known in advance.
+type StreamInterceptor interface {
+	Interceptor
+
+	// Transformer returns a [interceptor.InterceptorTransformer] that wraps the body of the response.
+	Transformer() InterceptorTransformer
+}
+
+// RequestInterceptorRuler defines a function that contains the rules to determine if a request must be intercepted or not
+// before it is sent to the origin.
+//
+// Receives an *[http.Request] received from the client to be evaluated by the rule.
+// Returns true if a request pass the rule, otherwise must be return false.
+type RequestInterceptorRuler func(*http.Request) bool
+
+// RequestInterceptorHandler defines a function that modifies a request before it is sent to the origin,
+// as rewriting its path or adding headers.
+//
+// Receives the [http.ResponseWriter] of the client and the *[http.Request] to modify.
+// Returns true if the handler wrote the response, so the request is short-circuited and never reaches the origin.
+type RequestInterceptorHandler func(http.ResponseWriter, *http.Request) (bool, error)
+
+// RequestInterceptor is the counterpart of [interceptor.Interceptor] that handles the requests instead of the responses.
+type RequestInterceptor interface {
+
+	// Rules returns a list of interceptor.RequestInterceptorRuler with the functions that it will validate
+	// if the request must be intercepted or not.
+	Rules() []RequestInterceptorRuler
+
+	// Handler returns a [interceptor.RequestInterceptorHandler] with all operations to modify or respond a request.
+	Handler() RequestInterceptorHandler
+}
@@ -0,0 +1,270 @@
+package livereload
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/mauroalderete/pkgsite-local-live/interceptor/csp"
+)
+
+// ClientPath is the path where the server exposes the script of the client, by default.
+const ClientPath = "/__reloader/client.js"
+
+// script is the source of the client, that connects to the server and reloads the page when it is notified.
+// It is rendered as a template with the [livereload.SnippetData] when the interceptor is built.
+//
+//go:embed client.js
+var script string
+
+// client is the template that loads the script of the client from the server.
+//
+// It is available to the snippets configured as the template named `client`,
+// so they can extend it with `{{template "client" .}}` instead of replacing it.
+const client = `<script src="{{html .ClientURL}}"{{with .Nonce}} nonce="{{html .}}"{{end}}{{with .Integrity}} integrity="{{html .}}"{{end}}></script>`
+
+// defaultSnippet is the snippet used when it isn't configured, that only renders the default client.
+const defaultSnippet = `{{template "client" .}}`
+
+// CSPSource defines how the script of the client is allowed by the Content-Security-Policy of the pages.
+type CSPSource int
+
+const (
+	// CSPNone doesn't modify the policy of the pages. It is the default source.
+	CSPNone CSPSource = iota
+
+	// CSPNonce adds a nonce to the script element, different for each page, and allows it in the policy.
+	CSPNonce
+
+	// CSPHash adds the hash of the script to the script element as its integrity, and allows it in the policy.
+	CSPHash
+)
+
+// String returns the name of the source, as accepted by [livereload.ParseCSPSource].
+func (s CSPSource) String() string {
+	switch s {
+	case CSPNone:
+		return "none"
+	case CSPNonce:
+		return "nonce"
+	case CSPHash:
+		return "hash"
+	}
+	return fmt.Sprintf("CSPSource(%d)", int(s))
+}
+
+// ParseCSPSource returns the source named `none`, `nonce` or `hash`.
+func ParseCSPSource(name string) (CSPSource, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return CSPNone, nil
+	case "nonce":
+		return CSPNonce, nil
+	case "hash":
+		return CSPHash, nil
+	}
+	return CSPNone, fmt.Errorf("unknown csp source '%s', it must be none, nonce or hash", name)
+}
+
+// SnippetData are the variables available to the snippet and to the script of the client,
+// that are rendered as [text/template] when the interceptor is built.
+//
+// The urls can be relative to the page, as `/ws`, so the snippet works whatever the address used to reach the server.
+// They must be escaped with the `js` function when they are written inside of a javascript string, as `'{{js .WebsocketURL}}'`.
+type SnippetData struct {
+
+	// WebsocketURL is the endpoint to establish the websocket connection.
+	WebsocketURL string
+
+	// SSEURL is the endpoint to listen the Server-Sent Events when the websocket can't connect.
+	SSEURL string
+
+	// ClientURL is the endpoint of the script of the client, versioned by the build id.
+	ClientURL string
+
+	// ReconnectInterval is the time in milliseconds to wait before trying to connect again when the connection is lost.
+	ReconnectInterval int64
+
+	// ProtocolVersion is the version of the messages sent by the server.
+	ProtocolVersion int
+
+	// BuildID identifies the instance of the server that rendered the snippet.
+	BuildID string
+
+	// Nonce is the nonce of the script element, only with [livereload.CSPNonce]. It is different for each page.
+	Nonce string
+
+	// Integrity is the hash of the script of the client, only with [livereload.CSPHash].
+	Integrity string
+}
+
+// data returns the variables configured.
+func (l *Livereload) data() SnippetData {
+	return SnippetData{
+		WebsocketURL:      l.upgradeEndpoint,
+		SSEURL:            l.eventsEndpoint,
+		ClientURL:         l.clientEndpoint + "?v=" + l.buildID,
+		ReconnectInterval: l.reconnectInterval.Milliseconds(),
+		ProtocolVersion:   l.protocolVersion,
+		BuildID:           l.buildID,
+	}
+}
+
+// render executes the script of the client and parses the snippet as templates with the variables configured.
+// If the snippet isn't configured, the default client is used.
+//
+// As the nonce changes for each page, with [livereload.CSPNonce] the snippet rendered here is only used without nonce.
+func (l *Livereload) render() error {
+	data := l.data()
+
+	source, err := template.New("script").Parse(script)
+	if err != nil {
+		return fmt.Errorf("failed to parse the client script template: %v", err)
+	}
+
+	rendered := &bytes.Buffer{}
+	err = source.Execute(rendered, data)
+	if err != nil {
+		return fmt.Errorf("failed to render the client script template: %v", err)
+	}
+
+	l.script = rendered.Bytes()
+
+	sum := sha256.Sum256(l.script)
+	l.hash = "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	snippet := template.New("snippet")
+
+	_, err = snippet.New("client").Parse(client)
+	if err != nil {
+		return fmt.Errorf("failed to parse the default client template: %v", err)
+	}
+
+	content := l.webserviceInjectable
+	if len(content) == 0 {
+		content = defaultSnippet
+	}
+
+	_, err = snippet.Parse(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse the snippet template: %v", err)
+	}
+
+	l.snippet = snippet
+
+	// with nonce, the snippet is rendered again for each page, this one is injected where the nonce can't be used
+	l.webserviceInjectable, err = l.execute("")
+	return err
+}
+
+// execute renders the snippet with the nonce passed.
+func (l *Livereload) execute(nonce string) (string, error) {
+	data := l.data()
+	data.Nonce = nonce
+
+	if l.csp == CSPHash {
+		data.Integrity = l.hash
+	}
+
+	rendered := &bytes.Buffer{}
+	err := l.snippet.Execute(rendered, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render the snippet template: %v", err)
+	}
+
+	return rendered.String(), nil
+}
+
+// inject returns the snippet to inject in the response, and allows the script in its Content-Security-Policy if it is configured.
+//
+// The nonce or the hash isn't added to the policies that allow the inline scripts by `'unsafe-inline'`,
+// because the browsers would ignore it and block the inline scripts of the page. In that case, the script
+// must be allowed by its url, as the csp interceptor does.
+// With `'strict-dynamic'` the url is ignored, so the nonce is added even if it isn't configured.
+func (l *Livereload) inject(r *http.Response) (string, error) {
+	source := l.csp
+	switch {
+	case csp.StrictDynamic(r.Header, "script-src"):
+		if source == CSPNone {
+			source = CSPNonce
+		}
+	case source != CSPNone && csp.UnsafeInline(r.Header, "script-src"):
+		source = CSPNone
+	}
+
+	switch source {
+	case CSPNonce:
+		nonce, err := newNonce()
+		if err != nil {
+			return "", err
+		}
+
+		snippet, err := l.execute(nonce)
+		if err != nil {
+			return "", err
+		}
+
+		csp.Allow(r.Header, "script-src", fmt.Sprintf("'nonce-%s'", nonce))
+		return fmt.Sprintf("\n%s\n", snippet), nil
+	case CSPHash:
+		csp.Allow(r.Header, "script-src", fmt.Sprintf("'%s'", l.hash))
+	}
+
+	return fmt.Sprintf("\n%s\n", l.webserviceInjectable), nil
+}
+
+// newNonce returns a random value encoded as base64, to use as nonce of a script element.
+func newNonce() (string, error) {
+	nonce := make([]byte, 16)
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate the nonce: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// ServeHTTP implements [http.Handler] interface. It serves the script of the client.
+//
+// The script requested with the current build id, as the snippet does, is cached by the browsers without expiration,
+// because other build id changes its url. Otherwise, the browsers must revalidate it with its ETag each time.
+func (l *Livereload) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		response.Header().Set("Allow", "GET, HEAD")
+		http.Error(response, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s"`, l.buildID)
+
+	header := response.Header()
+	header.Set("Content-Type", "text/javascript; charset=utf-8")
+	header.Set("ETag", etag)
+
+	if request.URL.Query().Get("v") == l.buildID {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	if request.Header.Get("If-None-Match") == etag {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Length", fmt.Sprint(len(l.script)))
+	response.WriteHeader(http.StatusOK)
+
+	if request.Method == http.MethodHead {
+		return
+	}
+
+	_, _ = response.Write(l.script)
+}
@@ -0,0 +1,132 @@
+if ('WebSocket' in window || 'EventSource' in window) {
+	(function () {
+		// the variables are rendered by the server when it starts
+		var websocketURL = '{{js .WebsocketURL}}';
+		var sseURL = '{{js .SSEURL}}';
+		var reconnectInterval = {{.ReconnectInterval}};
+		// version of the messages protocol understood by this client
+		var protocolVersion = {{.ProtocolVersion}};
+		var buildID = '{{js .BuildID}}';
+
+		function refreshCSS() {
+			var sheets = [].slice.call(document.getElementsByTagName("link"));
+			var head = document.getElementsByTagName("head")[0];
+			for (var i = 0; i < sheets.length; ++i) {
+				var elem = sheets[i];
+				var parent = elem.parentElement || head;
+				parent.removeChild(elem);
+				var rel = elem.rel;
+				if (elem.href && typeof rel != "string" || rel.length == 0 || rel.toLowerCase() == "stylesheet") {
+					var url = elem.href.replace(/(&|\?)_cacheOverride=\d+/, '');
+					elem.href = url + (url.indexOf('?') >= 0 ? '&' : '?') + '_cacheOverride=' + (new Date().valueOf());
+				}
+				parent.appendChild(elem);
+			}
+		}
+		// shows a banner with the status or the error notified by the server
+		function notify(text, failed) {
+			var banner = document.getElementById('pkgsite-live-banner');
+			if (!banner) {
+				banner = document.createElement('div');
+				banner.id = 'pkgsite-live-banner';
+				banner.style.cssText = 'position:fixed;bottom:1rem;right:1rem;z-index:2147483647;padding:.5rem 1rem;' +
+					'border-radius:.25rem;font:14px sans-serif;color:#fff;box-shadow:0 2px 6px rgba(0,0,0,.3);white-space:pre-wrap;max-width:40rem';
+				document.body.appendChild(banner);
+			}
+			banner.style.background = failed ? '#c5221f' : '#1a73e8';
+			banner.textContent = text;
+		}
+		function dismiss() {
+			var banner = document.getElementById('pkgsite-live-banner');
+			if (banner) banner.parentElement.removeChild(banner);
+		}
+		function handle(message) {
+			if (message.version > protocolVersion) {
+				console.warn('Live reload protocol version ' + message.version + ' is newer than ' + protocolVersion + '.');
+			}
+			switch (message.type) {
+				case 'reload':
+					window.location.reload();
+					break;
+				case 'css':
+					refreshCSS();
+					dismiss();
+					break;
+				case 'status':
+					notify(message.text || 'working...', false);
+					break;
+				case 'error':
+					notify(message.text || 'something went wrong', true);
+					break;
+				default:
+					console.warn('Unknown live reload message ' + message.type + '.');
+			}
+		}
+		function receive(msg) {
+			// the bare text messages are sent by the previous versions of the server
+			if (msg.data == 'reload') window.location.reload();
+			else if (msg.data == 'refreshcss') refreshCSS();
+			else {
+				try {
+					handle(JSON.parse(msg.data));
+				} catch (e) {
+					console.error('Invalid live reload message: ' + msg.data);
+				}
+			}
+		}
+		// resolves the endpoint with the address of the page, so it works behind other ports or hosts
+		function resolve(endpoint, websocket) {
+			var url = new URL(endpoint, window.location.href);
+			if (websocket) {
+				url.protocol = url.protocol === 'https:' || url.protocol === 'wss:' ? 'wss:' : 'ws:';
+			}
+			// the page allows the server reloads only the tabs viewing the modules changed
+			url.searchParams.set('page', window.location.pathname);
+			return url.toString();
+		}
+		// listens the event stream when the websocket can't connect, as behind proxies that don't allow the upgrade
+		function fallback() {
+			if (!('EventSource' in window)) {
+				console.error('Live reload could not connect to the server.');
+				return;
+			}
+			console.log('Live reload falls back to Server-Sent Events.');
+			var events = new EventSource(resolve(sseURL, false));
+			events.onmessage = receive;
+		}
+		// connects again when the connection is lost, and reloads the page when the server is back
+		var connected = false;
+		function connect() {
+			var opened = false;
+			var socket = new WebSocket(resolve(websocketURL, true));
+			socket.onopen = function () {
+				opened = true;
+				if (connected) {
+					window.location.reload();
+					return;
+				}
+				connected = true;
+			};
+			socket.onclose = function () {
+				if (!opened && !connected) {
+					fallback();
+					return;
+				}
+				setTimeout(connect, reconnectInterval);
+			};
+			socket.onmessage = receive;
+		}
+		if (!('WebSocket' in window)) {
+			fallback();
+		} else {
+			connect();
+		}
+		if (sessionStorage && !sessionStorage.getItem('IsThisFirstTime_Log_From_LiveServer')) {
+			console.log('Live reload enabled by the server ' + buildID + '.');
+			sessionStorage.setItem('IsThisFirstTime_Log_From_LiveServer', true);
+		}
+	})();
+}
+else {
+	console.error('Upgrade your browser. This Browser is NOT supported WebSocket nor EventSource for Live-Reloading.');
+}
@@ -0,0 +1,289 @@
+package livereload
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newClient returns a livereload without snippet, so it injects the default client, and with the csp source passed.
+func newClient(t *testing.T, source CSPSource) *Livereload {
+	t.Helper()
+
+	i, err := New(
+		func(c Configurer) error {
+			c.OpenFile(func(name string) (*os.File, error) {
+				return &os.File{}, nil
+			})
+
+			return c.ReadAll(io.ReadAll)
+		},
+		func(c Configurer) error {
+			err := c.UpgradeEndpoint("/ws")
+			if err != nil {
+				return err
+			}
+
+			err = c.BuildID("abc")
+			if err != nil {
+				return err
+			}
+
+			return c.CSP(source)
+		},
+	)
+	if err != nil {
+		t.Fatalf("want error nil, got '%v'", err)
+	}
+
+	return i.(*Livereload)
+}
+
+func TestServeClient(t *testing.T) {
+	l := newClient(t, CSPNone)
+
+	cases := map[string]struct {
+		method      string
+		url         string
+		ifNoneMatch string
+		status      int
+		cache       string
+		body        bool
+	}{
+		"versioned":     {http.MethodGet, "/__reloader/client.js?v=abc", "", http.StatusOK, "public, max-age=31536000, immutable", true},
+		"other version": {http.MethodGet, "/__reloader/client.js?v=old", "", http.StatusOK, "no-cache", true},
+		"unversioned":   {http.MethodGet, "/__reloader/client.js", "", http.StatusOK, "no-cache", true},
+		"not modified":  {http.MethodGet, "/__reloader/client.js", `"abc"`, http.StatusNotModified, "no-cache", false},
+		"modified":      {http.MethodGet, "/__reloader/client.js", `"old"`, http.StatusOK, "no-cache", true},
+		"head":          {http.MethodHead, "/__reloader/client.js?v=abc", "", http.StatusOK, "public, max-age=31536000, immutable", false},
+		"post":          {http.MethodPost, "/__reloader/client.js", "", http.StatusMethodNotAllowed, "", false},
+	}
+
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			request := httptest.NewRequest(c.method, c.url, nil)
+			if c.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", c.ifNoneMatch)
+			}
+			recorder := httptest.NewRecorder()
+
+			l.ServeHTTP(recorder, request)
+
+			if recorder.Code != c.status {
+				t.Fatalf("want status %d, got %d", c.status, recorder.Code)
+			}
+
+			if got := recorder.Header().Get("Cache-Control"); got != c.cache {
+				t.Errorf("want Cache-Control '%s', got '%s'", c.cache, got)
+			}
+
+			if c.status != http.StatusMethodNotAllowed && recorder.Header().Get("ETag") != `"abc"` {
+				t.Errorf("want ETag '\"abc\"', got '%s'", recorder.Header().Get("ETag"))
+			}
+
+			if c.body != (recorder.Body.String() == string(l.script)) {
+				t.Errorf("want the script sent %v, got '%s'", c.body, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestCSPSources(t *testing.T) {
+
+	// inject runs the handler over a page with the policy passed, and returns the response.
+	inject := func(t *testing.T, l *Livereload, policy string) (*http.Response, string) {
+		t.Helper()
+
+		r := &http.Response{
+			Header: http.Header{"Content-Security-Policy": []string{policy}},
+			Body:   io.NopCloser(strings.NewReader("<html><body></body></html>")),
+		}
+
+		err := l.Handler()(r)
+		if err != nil {
+			t.Fatalf("want error nil, got '%v'", err)
+		}
+
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("want error nil, got '%v'", err)
+		}
+
+		return r, string(content)
+	}
+
+	t.Run("none", func(t *testing.T) {
+		r, content := inject(t, newClient(t, CSPNone), "script-src 'self'")
+
+		if got := r.Header.Get("Content-Security-Policy"); got != "script-src 'self'" {
+			t.Errorf("want the policy unmodified, got '%s'", got)
+		}
+
+		if !strings.Contains(content, `<script src="/__reloader/client.js?v=abc"></script>`) {
+			t.Errorf("want the script element injected, got '%s'", content)
+		}
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		l := newClient(t, CSPNonce)
+
+		nonces := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			r, content := inject(t, l, "script-src 'self'")
+
+			match := regexp.MustCompile(`<script src="/__reloader/client.js\?v=abc" nonce="([^"]+)"></script>`).FindStringSubmatch(content)
+			if match == nil {
+				t.Fatalf("want the script element with nonce injected, got '%s'", content)
+			}
+
+			if want := "script-src 'self' 'nonce-" + match[1] + "'"; r.Header.Get("Content-Security-Policy") != want {
+				t.Errorf("want policy '%s', got '%s'", want, r.Header.Get("Content-Security-Policy"))
+			}
+
+			nonces[match[1]] = true
+		}
+
+		if len(nonces) != 2 {
+			t.Errorf("want a different nonce for each page, got %v", nonces)
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		l := newClient(t, CSPHash)
+
+		sum := sha256.Sum256(l.script)
+		hash := "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+
+		r, content := inject(t, l, "default-src 'self'")
+
+		if want := `<script src="/__reloader/client.js?v=abc" integrity="` + hash + `"></script>`; !strings.Contains(content, want) {
+			t.Errorf("want '%s' injected, got '%s'", want, content)
+		}
+
+		if want := "default-src 'self'; script-src 'self' '" + hash + "'"; r.Header.Get("Content-Security-Policy") != want {
+			t.Errorf("want policy '%s', got '%s'", want, r.Header.Get("Content-Security-Policy"))
+		}
+	})
+}
+
+func TestCSPUnsafeInline(t *testing.T) {
+	cases := map[string]struct {
+		source   CSPSource
+		policy   string
+		modified bool
+	}{
+		"nonce with unsafe-inline":  {CSPNonce, "script-src 'self' 'unsafe-inline'", false},
+		"hash with unsafe-inline":   {CSPHash, "default-src 'self' 'unsafe-inline'", false},
+		"nonce with other nonce":    {CSPNonce, "script-src 'unsafe-inline' 'nonce-origin'", true},
+		"hash with other hash":      {CSPHash, "script-src 'unsafe-inline' 'sha256-origin'", true},
+		"unsafe-inline of styles":   {CSPNonce, "script-src 'self'; style-src 'unsafe-inline'", true},
+		"unsafe-inline report only": {CSPNonce, "", false},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			l := newClient(t, c.source)
+
+			r := &http.Response{
+				Header: http.Header{},
+				Body:   io.NopCloser(strings.NewReader("<html><body></body></html>")),
+			}
+			if c.policy != "" {
+				r.Header.Set("Content-Security-Policy", c.policy)
+			} else {
+				r.Header.Set("Content-Security-Policy", "script-src 'self'")
+				r.Header.Set("Content-Security-Policy-Report-Only", "script-src 'unsafe-inline'")
+			}
+			policy := r.Header.Get("Content-Security-Policy")
+
+			err := l.Handler()(r)
+			if err != nil {
+				t.Fatalf("want error nil, got '%v'", err)
+			}
+
+			content, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("want error nil, got '%v'", err)
+			}
+
+			if got := r.Header.Get("Content-Security-Policy") != policy; got != c.modified {
+				t.Errorf("want policy modified %v, got '%s'", c.modified, r.Header.Get("Content-Security-Policy"))
+			}
+
+			if !c.modified && strings.Contains(string(content), "nonce=") {
+				t.Errorf("want the script element without nonce, got '%s'", content)
+			}
+
+			if !strings.Contains(string(content), `<script src="/__reloader/client.js?v=abc"`) {
+				t.Errorf("want the script element injected, got '%s'", content)
+			}
+		})
+	}
+}
+
+func TestCSPStrictDynamic(t *testing.T) {
+	for _, source := range []CSPSource{CSPNone, CSPNonce} {
+		t.Run(source.String(), func(t *testing.T) {
+			l := newClient(t, source)
+
+			r := &http.Response{
+				Header: http.Header{"Content-Security-Policy": []string{"script-src 'nonce-origin' 'strict-dynamic' 'unsafe-inline'"}},
+				Body:   io.NopCloser(strings.NewReader("<html><body></body></html>")),
+			}
+
+			err := l.Handler()(r)
+			if err != nil {
+				t.Fatalf("want error nil, got '%v'", err)
+			}
+
+			content, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("want error nil, got '%v'", err)
+			}
+
+			match := regexp.MustCompile(`<script src="/__reloader/client.js\?v=abc" nonce="([^"]+)"></script>`).FindStringSubmatch(string(content))
+			if match == nil {
+				t.Fatalf("want the script element with nonce injected, got '%s'", content)
+			}
+
+			want := "script-src 'nonce-origin' 'strict-dynamic' 'unsafe-inline' 'nonce-" + match[1] + "'"
+			if got := r.Header.Get("Content-Security-Policy"); got != want {
+				t.Errorf("want policy '%s', got '%s'", want, got)
+			}
+		})
+	}
+}
+
+func TestParseCSPSource(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		expected CSPSource
+		fail     bool
+	}{
+		"empty":   {"", CSPNone, false},
+		"none":    {"none", CSPNone, false},
+		"nonce":   {" Nonce ", CSPNonce, false},
+		"hash":    {"hash", CSPHash, false},
+		"unknown": {"sha1", CSPNone, true},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			source, err := ParseCSPSource(c.name)
+			if (err != nil) != c.fail {
+				t.Fatalf("expected error %v, got '%v'", c.fail, err)
+			}
+
+			if source != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, source)
+			}
+		})
+	}
+}
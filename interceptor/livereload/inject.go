@@ -0,0 +1,121 @@
+package livereload
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Position defines where the snippet is injected in the html page.
+type Position int
+
+const (
+	// BodyEnd injects the snippet before the closing body element. It is the default position.
+	BodyEnd Position = iota
+
+	// HeadEnd injects the snippet before the closing head element,
+	// so the client connects before the body is rendered.
+	HeadEnd
+)
+
+// String returns the name of the position, as accepted by [livereload.ParsePosition].
+func (p Position) String() string {
+	switch p {
+	case BodyEnd:
+		return "body"
+	case HeadEnd:
+		return "head"
+	}
+	return fmt.Sprintf("Position(%d)", int(p))
+}
+
+// ParsePosition returns the position named `body` or `head`.
+func ParsePosition(name string) (Position, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "body":
+		return BodyEnd, nil
+	case "head":
+		return HeadEnd, nil
+	}
+	return BodyEnd, fmt.Errorf("unknown injection position '%s', it must be body or head", name)
+}
+
+// elements stores the offsets of the elements of an html page useful to inject the snippet.
+// The offsets are -1 if the element wasn't found.
+type elements struct {
+	headEnd   int
+	bodyStart int
+	bodyEnd   int
+	htmlEnd   int
+}
+
+// scan tokenizes the page to find the offsets of the elements.
+//
+// As the tokenizer knows the elements whose content is raw text, as `script`, `style` or `textarea`,
+// and the comments, the tags written inside of them aren't considered.
+func scan(content []byte) elements {
+	found := elements{-1, -1, -1, -1}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	offset := 0
+
+	for {
+		t := tokenizer.Next()
+		if t == html.ErrorToken {
+			// the error is io.EOF when the page ends, any other can't happen reading from memory
+			if tokenizer.Err() != io.EOF {
+				return found
+			}
+			break
+		}
+
+		start := offset
+		offset += len(tokenizer.Raw())
+
+		name, _ := tokenizer.TagName()
+		switch a := atom.Lookup(name); {
+		case t == html.StartTagToken && a == atom.Body && found.bodyStart < 0:
+			found.bodyStart = start
+		case t == html.EndTagToken && a == atom.Head && found.headEnd < 0:
+			found.headEnd = start
+		case t == html.EndTagToken && a == atom.Body:
+			found.bodyEnd = start
+		case t == html.EndTagToken && a == atom.Html:
+			found.htmlEnd = start
+		}
+	}
+
+	return found
+}
+
+// injectionPoint returns the offset of the page where the snippet must be injected.
+//
+// For [livereload.BodyEnd], it is the last closing body element.
+// For [livereload.HeadEnd], it is the closing head element, or the opening body element if the head isn't closed.
+// If the elements aren't found, it falls back to the closing html element or to the end of the page.
+func injectionPoint(content []byte, position Position) int {
+	found := scan(content)
+
+	if position == HeadEnd {
+		if found.headEnd >= 0 {
+			return found.headEnd
+		}
+		if found.bodyStart >= 0 {
+			return found.bodyStart
+		}
+	}
+
+	if found.bodyEnd >= 0 {
+		return found.bodyEnd
+	}
+
+	if found.htmlEnd >= 0 {
+		return found.htmlEnd
+	}
+
+	return len(content)
+}
@@ -0,0 +1,66 @@
+package livereload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInjectionPoint(t *testing.T) {
+	cases := map[string]struct {
+		content  string
+		position Position
+		expected string
+	}{
+		"body":                 {"<html><body>a</body></html>", BodyEnd, "</body></html>"},
+		"body in code block":   {"<html><body><pre><code>&lt;body&gt;</code></pre></body></html>", BodyEnd, "</body></html>"},
+		"body in script":       {"<html><body><script>document.write('</body>')</script>a</body></html>", BodyEnd, "</body></html>"},
+		"body in comment":      {"<html><body>a<!-- </body> --></body></html>", BodyEnd, "</body></html>"},
+		"body in textarea":     {"<html><body><textarea><body></body></textarea></body></html>", BodyEnd, "</body></html>"},
+		"two body elements":    {"<html><body><body>a</body></body></html>", BodyEnd, "</body></html>"},
+		"body upper case":      {"<HTML><BODY>a</BODY></HTML>", BodyEnd, "</BODY></HTML>"},
+		"without body end":     {"<html><body>a</html>", BodyEnd, "</html>"},
+		"fragment":             {"<p>a</p>", BodyEnd, ""},
+		"head":                 {"<html><head><title>a</title></head><body></body></html>", HeadEnd, "</head><body></body></html>"},
+		"head in style":        {"<html><head><style>/* </head> */</style></head><body></body></html>", HeadEnd, "</head><body></body></html>"},
+		"without head end":     {"<html><head><title>a</title><body>a</body></html>", HeadEnd, "<body>a</body></html>"},
+		"without head or body": {"<html>a</html>", HeadEnd, "</html>"},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			location := injectionPoint([]byte(c.content), c.position)
+			if location < 0 || location > len(c.content) {
+				t.Fatalf("expected a location inside the content, got %d", location)
+			}
+
+			if !strings.HasSuffix(c.content, c.expected) || c.content[location:] != c.expected {
+				t.Errorf("expected inject before '%s', got before '%s'", c.expected, c.content[location:])
+			}
+		})
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	cases := map[string]struct {
+		name     string
+		expected Position
+		fail     bool
+	}{
+		"body":    {"body", BodyEnd, false},
+		"head":    {" HEAD ", HeadEnd, false},
+		"unknown": {"footer", BodyEnd, true},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			position, err := ParsePosition(c.name)
+			if (err != nil) != c.fail {
+				t.Fatalf("expected error %v, got '%v'", c.fail, err)
+			}
+
+			if position != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, position)
+			}
+		})
+	}
+}
@@ -1,30 +1,47 @@
-// Package liverreload injects in a html page requested a snippet from a filepath
+// Package liverreload injects in a html page requested a snippet from a filepath, or a default client embedded,
 // to handle a livereload system in client side.
 package livereload
 
 import (
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"text/template"
+	"time"
 
 	"github.com/mauroalderete/pkgsite-local-live/interceptor"
 
-	"regexp"
 	"strings"
 )
 
+// Mark is the name that livereload marks the responses where it injects the snippet, as they are known by [interceptor.Marked].
+// When the page is streamed, the response is marked before its content is read.
+const Mark = "livereload"
+
 type OpenFile func(name string) (*os.File, error)
 type ReadAll func(r io.Reader) ([]byte, error)
 
-// Livereload implements [interceptor.Interceptor] interface
+// Livereload implements [interceptor.Interceptor] and [interceptor.StreamInterceptor] interfaces,
+// and [http.Handler] to serve the script of the client.
 type Livereload struct {
 	webserviceInjectable string
 	rules                []interceptor.InterceptorRuler
 	upgradeEndpoint      string
+	eventsEndpoint       string
+	reconnectInterval    time.Duration
+	protocolVersion      int
+	buildID              string
+	clientEndpoint       string
+	csp                  CSPSource
+	snippet              *template.Template
+	script               []byte
+	hash                 string
 	openFile             OpenFile
 	readAll              ReadAll
+	position             Position
 }
 
 // Rules implements [interceptor.Interceptor.Rules] method.
@@ -37,8 +54,12 @@ func (l *Livereload) Rules() []interceptor.InterceptorRuler {
 // Handler implements [interceptor.Interceptor.Handler] method.
 // Returns a interceptor.InterceptorHandler callback.
 //
-// The method returned access to the content and inject before the tag `</body>`
-// the snippet passed as option during the build of a instance of [liverreload.livereload].
+// The method returned access to the content and inject before the closing `</body>` element,
+// or the closing `</head>` element if it is configured, the snippet passed as option
+// during the build of a instance of [liverreload.livereload].
+// The elements are found by an html tokenizer, so the tags written inside of scripts, styles or comments are ignored.
+// If the elements aren't found, the snippet is injected before `</html>` or at the end of the content.
+// The empty contents aren't modified.
 func (l *Livereload) Handler() interceptor.InterceptorHandler {
 	return func(r *http.Response) error {
 		content, err := getBody(r, l.readAll)
@@ -46,29 +67,57 @@ func (l *Livereload) Handler() interceptor.InterceptorHandler {
 			return fmt.Errorf("failed to get body: %v", err)
 		}
 
-		exp := regexp.MustCompile("</body>")
-		location := exp.FindIndex([]byte(content))
+		if len(content) == 0 {
+			r.Body = io.NopCloser(strings.NewReader(content))
+			return nil
+		}
+
+		snippet, err := l.inject(r)
+		if err != nil {
+			return fmt.Errorf("failed to prepare the snippet: %v", err)
+		}
+
+		location := injectionPoint([]byte(content), l.position)
 
-		contentModified := content[:location[0]]
-		contentModified += fmt.Sprintf("\n%s\n", l.webserviceInjectable)
-		contentModified += content[location[0]:]
+		contentModified := content[:location]
+		contentModified += snippet
+		contentModified += content[location:]
 
 		r.Body = io.NopCloser(strings.NewReader(contentModified))
 		r.ContentLength = int64(len(contentModified))
 		r.Header.Set("Content-Length", strconv.Itoa(len(contentModified)))
 
+		interceptor.Mark(r, Mark)
+
 		return nil
 	}
 }
 
+// Transformer implements [interceptor.StreamInterceptor.Transformer] method.
+// Returns a interceptor.InterceptorTransformer callback.
+//
+// The method returned wraps the content with a reader that injects the snippet in the same place than [livereload.Livereload.Handler],
+// but while the content is sent, so the large pages aren't loaded whole in memory.
+func (l *Livereload) Transformer() interceptor.InterceptorTransformer {
+	return func(r *http.Response, body io.Reader) io.Reader {
+		snippet, err := l.inject(r)
+		if err != nil {
+			// the page is sent without the snippet, as the interceptors that fail
+			log.Printf("the snippet isn't injected in %s: %v", r.Request.URL, err)
+			return body
+		}
+
+		interceptor.Mark(r, Mark)
+
+		return newInjector(body, []byte(snippet), l.position)
+	}
+}
+
 // statusCodeRule validates that the response requested has a status code 200.
+//
+// A 304 response has no body where to inject the snippet, the browser uses the page that it cached before.
 func statusCodeRule(r *http.Response) bool {
-	switch r.StatusCode {
-	case 200, 304:
-		return true
-	default:
-		return false
-	}
+	return r.StatusCode == http.StatusOK
 }
 
 // contentTypeRule validates that the content-type of the response requested is a `text/hmlt`.
@@ -90,23 +139,6 @@ func contentTypeRule(r *http.Response) bool {
 	return isTextHML
 }
 
-// hasOneBodyTagRule validates that the response requested has only one body HTML tag pair.
-func hasOneBodyTagRule(r *http.Response, Reader ReadAll) bool {
-	content, err := getBody(r, Reader)
-	if err != nil {
-		return false
-	}
-
-	openTagExp := regexp.MustCompile("<body")
-	closeTagExp := regexp.MustCompile("</body>")
-	openTagMatchs := openTagExp.FindAll([]byte(content), -1)
-	closeTagMatchs := closeTagExp.FindAll([]byte(content), -1)
-
-	r.Body = io.NopCloser(strings.NewReader(content))
-
-	return len(openTagMatchs) == 1 && len(closeTagMatchs) == 1
-}
-
 // getBody allows access to a copy of the body content
 // while maintaining open the body in response requested to future readings.
 func getBody(r *http.Response, Reader ReadAll) (string, error) {
@@ -127,6 +159,7 @@ type Configurer interface {
 
 	// WebserviceInjectable receives the path of file that contains the snippet
 	// that must be injected in the body content.
+	// If it isn't configured, or the file is empty, the default client is injected.
 	//
 	// Returns an error if failed to get the file or parse it.
 	WebserviceInjectable(path string) error
@@ -135,9 +168,32 @@ type Configurer interface {
 	// to establish the connection with a WebSocket.
 	UpgradeEndpoint(url string) error
 
+	// EventsEndpoint sets the endpoint that the snippet listens when the websocket can't connect.
+	// By default, it is the upgrade endpoint followed by `/events`.
+	EventsEndpoint(url string) error
+
+	// ReconnectInterval sets the time that the snippet waits before connecting again when the connection is lost.
+	ReconnectInterval(interval time.Duration) error
+
+	// ProtocolVersion sets the version of the messages sent by the server.
+	ProtocolVersion(version int) error
+
+	// BuildID sets the identifier of the instance of the server, available to the snippet.
+	BuildID(id string) error
+
+	// ClientEndpoint sets the endpoint where the server exposes the script of the client.
+	// By default, it is [livereload.ClientPath].
+	ClientEndpoint(url string) error
+
+	// CSP sets how the script of the client is allowed by the Content-Security-Policy of the pages.
+	CSP(source CSPSource) error
+
 	OpenFile(openFile OpenFile) error
 
 	ReadAll(readAll ReadAll) error
+
+	// InjectionPoint sets where the snippet is injected, at the end of the body or of the head.
+	InjectionPoint(position Position) error
 }
 
 // configurer implement the [livereload.Configurer] interface.
@@ -187,6 +243,96 @@ func (c *configurer) UpgradeEndpoint(url string) error {
 	return nil
 }
 
+// EventsEndpoint implements [livereload.Configurer.EventsEndpoint] method.
+func (c *configurer) EventsEndpoint(url string) error {
+
+	if len(url) == 0 {
+		return fmt.Errorf("events endpoint cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(l *Livereload) error {
+		l.eventsEndpoint = url
+		return nil
+	})
+
+	return nil
+}
+
+// ReconnectInterval implements [livereload.Configurer.ReconnectInterval] method.
+func (c *configurer) ReconnectInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("reconnect interval must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(l *Livereload) error {
+		l.reconnectInterval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// ProtocolVersion implements [livereload.Configurer.ProtocolVersion] method.
+func (c *configurer) ProtocolVersion(version int) error {
+
+	if version <= 0 {
+		return fmt.Errorf("protocol version must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(l *Livereload) error {
+		l.protocolVersion = version
+		return nil
+	})
+
+	return nil
+}
+
+// BuildID implements [livereload.Configurer.BuildID] method.
+func (c *configurer) BuildID(id string) error {
+
+	if len(id) == 0 {
+		return fmt.Errorf("build id cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(l *Livereload) error {
+		l.buildID = id
+		return nil
+	})
+
+	return nil
+}
+
+// ClientEndpoint implements [livereload.Configurer.ClientEndpoint] method.
+func (c *configurer) ClientEndpoint(url string) error {
+
+	if len(url) == 0 {
+		return fmt.Errorf("client endpoint cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(l *Livereload) error {
+		l.clientEndpoint = url
+		return nil
+	})
+
+	return nil
+}
+
+// CSP implements [livereload.Configurer.CSP] method.
+func (c *configurer) CSP(source CSPSource) error {
+
+	if source != CSPNone && source != CSPNonce && source != CSPHash {
+		return fmt.Errorf("unknown csp source %v", source)
+	}
+
+	c.pool = append(c.pool, func(l *Livereload) error {
+		l.csp = source
+		return nil
+	})
+
+	return nil
+}
+
 func (c *configurer) OpenFile(openFile OpenFile) error {
 
 	if openFile == nil {
@@ -215,21 +361,44 @@ func (c *configurer) ReadAll(readAll ReadAll) error {
 	return nil
 }
 
+// InjectionPoint implements [livereload.Configurer.InjectionPoint] method.
+func (c *configurer) InjectionPoint(position Position) error {
+
+	if position != BodyEnd && position != HeadEnd {
+		return fmt.Errorf("unknown injection position %v", position)
+	}
+
+	c.pool = append(c.pool, func(l *Livereload) error {
+		l.position = position
+		return nil
+	})
+
+	return nil
+}
+
 // New returns a [livereload.Livereload] instance that implements the [interceptor.Interceptor] interface.
 //
 // Receive a list of configurations callback to apply the options.
 // It function try to access to the file with the snippet to inject
 // and configures the rules needed to identify the request that must be injected.
+// By default, the snippet is injected at the end of the body.
+//
+// The snippet is rendered as a template with the variables of [livereload.SnippetData],
+// and it can include the default client with `{{template "client" .}}`. Without snippet, only the default client is injected,
+// that is a script element that loads the client served by [livereload.Livereload.ServeHTTP].
+// By default, the reconnect interval is 2 seconds, the protocol version is 1, and the build id is generated from the current time.
 func New(options ...func(Configurer) error) (interceptor.Interceptor, error) {
 
-	livereload := &Livereload{}
+	livereload := &Livereload{
+		reconnectInterval: 2 * time.Second,
+		protocolVersion:   1,
+		buildID:           strconv.FormatInt(time.Now().UnixNano(), 36),
+		clientEndpoint:    ClientPath,
+	}
 
 	livereload.rules = []interceptor.InterceptorRuler{
 		statusCodeRule,
 		contentTypeRule,
-		func(r *http.Response) bool {
-			return hasOneBodyTagRule(r, livereload.readAll)
-		},
 	}
 
 	configurer := &configurer{}
@@ -258,13 +427,18 @@ func New(options ...func(Configurer) error) (interceptor.Interceptor, error) {
 		}
 	}
 
-	if len(livereload.webserviceInjectable) == 0 {
-		return nil, fmt.Errorf("a webserviceInjectable is required")
-	}
-
 	if len(livereload.upgradeEndpoint) == 0 {
 		return nil, fmt.Errorf("a reload endpoint is required")
 	}
 
+	if len(livereload.eventsEndpoint) == 0 {
+		livereload.eventsEndpoint = strings.TrimSuffix(livereload.upgradeEndpoint, "/") + "/events"
+	}
+
+	err := livereload.render()
+	if err != nil {
+		return nil, err
+	}
+
 	return livereload, nil
 }
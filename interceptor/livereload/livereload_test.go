@@ -7,6 +7,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/mauroalderete/pkgsite-local-live/interceptor"
 )
 
 func TestConfigureOpenFileNil(t *testing.T) {
@@ -253,7 +256,7 @@ func TestRules(t *testing.T) {
 		return
 	}
 
-	expected := 3
+	expected := 2
 	got := len(livereload.Rules())
 	if expected != got {
 		t.Errorf("expected %d rules, got %d", expected, got)
@@ -320,7 +323,7 @@ func TestNew(t *testing.T) {
 	})
 
 	t.Run("without webserviceInjectable", func(t *testing.T) {
-		_, err := New(
+		l, err := New(
 			func(c Configurer) error {
 				c.OpenFile(func(name string) (*os.File, error) {
 					return &os.File{}, nil
@@ -340,10 +343,14 @@ func TestNew(t *testing.T) {
 				return nil
 			},
 		)
-		if err == nil {
-			t.Errorf("want an error, got nil")
+		if err != nil {
+			t.Errorf("want error nil, got '%v'", err)
 			return
 		}
+
+		if !strings.Contains(l.(*Livereload).webserviceInjectable, `<script src="/__reloader/client.js?v=`) {
+			t.Errorf("want the default client, got '%s'", l.(*Livereload).webserviceInjectable)
+		}
 	})
 
 	t.Run("without endpoint", func(t *testing.T) {
@@ -419,7 +426,8 @@ func TestStatusCodeRule(t *testing.T) {
 		expected bool
 	}{
 		"200": {&http.Response{StatusCode: 200}, true},
-		"304": {&http.Response{StatusCode: 304}, true},
+		"304": {&http.Response{StatusCode: 304}, false},
+		"206": {&http.Response{StatusCode: 206}, false},
 		"404": {&http.Response{StatusCode: 404}, false},
 		"501": {&http.Response{StatusCode: 501}, false},
 	}
@@ -456,39 +464,6 @@ func TestContentTypeRule(t *testing.T) {
 	}
 }
 
-type nopCloserMock struct {
-	io.Reader
-	close func() error
-}
-
-func (ncm *nopCloserMock) Close() error { return ncm.close() }
-
-func TestHasOneBodyTagRule(t *testing.T) {
-	cases := map[string]struct {
-		response *http.Response
-		reader   func(r io.Reader) ([]byte, error)
-		expected bool
-	}{
-		"empty":              {&http.Response{Body: io.NopCloser(strings.NewReader(""))}, func(r io.Reader) ([]byte, error) { return io.ReadAll(r) }, false},
-		"only open tag":      {&http.Response{Body: io.NopCloser(strings.NewReader("abc<body>abc"))}, func(r io.Reader) ([]byte, error) { return io.ReadAll(r) }, false},
-		"only close tag":     {&http.Response{Body: io.NopCloser(strings.NewReader("abc</body>abc"))}, func(r io.Reader) ([]byte, error) { return io.ReadAll(r) }, false},
-		"two open one close": {&http.Response{Body: io.NopCloser(strings.NewReader("abc<body>abc<body>abc</body>abc"))}, func(r io.Reader) ([]byte, error) { return io.ReadAll(r) }, false},
-		"one open two close": {&http.Response{Body: io.NopCloser(strings.NewReader("abc<body>abc</body>abc</body>abc"))}, func(r io.Reader) ([]byte, error) { return io.ReadAll(r) }, false},
-		"reader failed":      {&http.Response{Body: io.NopCloser(strings.NewReader(""))}, func(r io.Reader) ([]byte, error) { return nil, fmt.Errorf("some was wrong") }, false},
-		"close filed":        {&http.Response{Body: &nopCloserMock{strings.NewReader(""), func() error { return fmt.Errorf("some was wrong") }}}, func(r io.Reader) ([]byte, error) { return io.ReadAll(r) }, false},
-		"succefull":          {&http.Response{Body: io.NopCloser(strings.NewReader("abc<body>abc</body>abc"))}, func(r io.Reader) ([]byte, error) { return io.ReadAll(r) }, true},
-	}
-
-	for n, c := range cases {
-		t.Run(n, func(t *testing.T) {
-			if hasOneBodyTagRule(c.response, c.reader) != c.expected {
-				t.Errorf("expected %v, got %v", c.expected, !c.expected)
-				return
-			}
-		})
-	}
-}
-
 func TestInterceptor(t *testing.T) {
 	livereload := &Livereload{}
 
@@ -537,3 +512,290 @@ func TestInterceptorError(t *testing.T) {
 		return
 	}
 }
+
+func TestInterceptorPosition(t *testing.T) {
+	page := `<html><head><title>t</title></head><body><pre>&lt;body&gt;</pre><script>var s = "</body>";</script></body></html>`
+
+	cases := map[string]struct {
+		position Position
+		content  string
+		expected string
+	}{
+		"body": {BodyEnd, page, `<html><head><title>t</title></head><body><pre>&lt;body&gt;</pre><script>var s = "</body>";</script>
+snippet
+</body></html>`},
+		"head": {HeadEnd, page, `<html><head><title>t</title>
+snippet
+</head><body><pre>&lt;body&gt;</pre><script>var s = "</body>";</script></body></html>`},
+		"empty": {BodyEnd, "", ""},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			livereload := &Livereload{
+				webserviceInjectable: "snippet",
+				readAll:              io.ReadAll,
+				position:             c.position,
+			}
+
+			response := &http.Response{
+				Body:   io.NopCloser(strings.NewReader(c.content)),
+				Header: make(http.Header),
+			}
+
+			err := livereload.Handler()(response)
+			if err != nil {
+				t.Fatalf("failed to try execute the handler: %v", err)
+			}
+
+			result, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatalf("failed to try read response modified: %v", err)
+			}
+
+			if string(result) != c.expected {
+				t.Errorf("expected '%s', got '%s'", c.expected, string(result))
+			}
+		})
+	}
+}
+
+func TestConfigureInjectionPoint(t *testing.T) {
+	config := &configurer{}
+
+	err := config.InjectionPoint(Position(10))
+	if err == nil {
+		t.Errorf("want an error, got nil")
+	}
+
+	err = config.InjectionPoint(HeadEnd)
+	if err != nil {
+		t.Errorf("want error nil, got '%s'", err)
+	}
+}
+
+func TestSnippetTemplate(t *testing.T) {
+
+	// build returns a livereload with the snippet passed and the options of the configure function.
+	build := func(snippet string, configure func(c Configurer) error) (*Livereload, error) {
+		i, err := New(
+			func(c Configurer) error {
+				c.OpenFile(func(name string) (*os.File, error) {
+					return &os.File{}, nil
+				})
+
+				c.ReadAll(func(r io.Reader) ([]byte, error) {
+					return []byte(snippet), nil
+				})
+				return nil
+			},
+			func(c Configurer) error {
+				err := c.UpgradeEndpoint("/ws")
+				if err != nil {
+					return err
+				}
+
+				err = c.WebserviceInjectable("some pathfile")
+				if err != nil {
+					return err
+				}
+
+				return configure(c)
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		return i.(*Livereload), nil
+	}
+
+	const snippet = "{{js .WebsocketURL}} {{.SSEURL}} {{.ReconnectInterval}} {{.ProtocolVersion}} {{.BuildID}}"
+
+	t.Run("configured", func(t *testing.T) {
+		l, err := build(snippet, func(c Configurer) error {
+			err := c.EventsEndpoint("/events")
+			if err != nil {
+				return err
+			}
+			err = c.ReconnectInterval(500 * time.Millisecond)
+			if err != nil {
+				return err
+			}
+			err = c.ProtocolVersion(3)
+			if err != nil {
+				return err
+			}
+			return c.BuildID("abc")
+		})
+		if err != nil {
+			t.Fatalf("want error nil, got '%v'", err)
+		}
+
+		if want := "/ws /events 500 3 abc"; l.webserviceInjectable != want {
+			t.Errorf("want '%s', got '%s'", want, l.webserviceInjectable)
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		l, err := build(snippet, func(c Configurer) error { return nil })
+		if err != nil {
+			t.Fatalf("want error nil, got '%v'", err)
+		}
+
+		want := fmt.Sprintf("/ws /ws/events 2000 1 %s", l.buildID)
+		if l.buildID == "" || l.webserviceInjectable != want {
+			t.Errorf("want '%s', got '%s'", want, l.webserviceInjectable)
+		}
+	})
+
+	t.Run("escaped", func(t *testing.T) {
+		l, err := build("'{{js .WebsocketURL}}'", func(c Configurer) error {
+			return c.UpgradeEndpoint("/it's")
+		})
+		if err != nil {
+			t.Fatalf("want error nil, got '%v'", err)
+		}
+
+		if want := `'/it\'s'`; l.webserviceInjectable != want {
+			t.Errorf("want '%s', got '%s'", want, l.webserviceInjectable)
+		}
+	})
+
+	t.Run("without variables", func(t *testing.T) {
+		l, err := build("<script>reload()</script>", func(c Configurer) error { return nil })
+		if err != nil {
+			t.Fatalf("want error nil, got '%v'", err)
+		}
+
+		if want := "<script>reload()</script>"; l.webserviceInjectable != want {
+			t.Errorf("want '%s', got '%s'", want, l.webserviceInjectable)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := build("{{.WebsocketURL", func(c Configurer) error { return nil })
+		if err == nil {
+			t.Errorf("want an error, got nil")
+		}
+	})
+
+	t.Run("unknown variable", func(t *testing.T) {
+		_, err := build("{{.Unknown}}", func(c Configurer) error { return nil })
+		if err == nil {
+			t.Errorf("want an error, got nil")
+		}
+	})
+
+	t.Run("default client", func(t *testing.T) {
+		l, err := build("", func(c Configurer) error { return c.BuildID("abc") })
+		if err != nil {
+			t.Fatalf("want error nil, got '%v'", err)
+		}
+
+		if want := `<script src="/__reloader/client.js?v=abc"></script>`; l.webserviceInjectable != want {
+			t.Errorf("want '%s', got '%s'", want, l.webserviceInjectable)
+		}
+
+		for _, want := range []string{"var websocketURL = '/ws';", "var sseURL = '/ws/events';", "var reconnectInterval = 2000;", "var buildID = 'abc';"} {
+			if !strings.Contains(string(l.script), want) {
+				t.Errorf("want the script contains '%s'", want)
+			}
+		}
+	})
+}
+
+func TestSnippetExtendsClient(t *testing.T) {
+	l, err := New(
+		func(c Configurer) error {
+			c.OpenFile(func(name string) (*os.File, error) {
+				return &os.File{}, nil
+			})
+
+			c.ReadAll(func(r io.Reader) ([]byte, error) {
+				return []byte(`<style>.banner{}</style>{{template "client" .}}<script>console.log('{{js .BuildID}}')</script>`), nil
+			})
+			return nil
+		},
+		func(c Configurer) error {
+			err := c.UpgradeEndpoint("/ws")
+			if err != nil {
+				return err
+			}
+
+			err = c.BuildID("abc")
+			if err != nil {
+				return err
+			}
+
+			return c.WebserviceInjectable("some pathfile")
+		},
+	)
+	if err != nil {
+		t.Fatalf("want error nil, got '%v'", err)
+	}
+
+	snippet := l.(*Livereload).webserviceInjectable
+
+	want := `<style>.banner{}</style><script src="/__reloader/client.js?v=abc"></script><script>console.log('abc')</script>`
+	if snippet != want {
+		t.Errorf("want '%s', got '%s'", want, snippet)
+	}
+}
+
+func TestConfigureSnippetVariables(t *testing.T) {
+	config := &configurer{}
+
+	cases := map[string]error{
+		"empty events endpoint": config.EventsEndpoint(""),
+		"zero reconnect":        config.ReconnectInterval(0),
+		"zero protocol":         config.ProtocolVersion(0),
+		"empty build id":        config.BuildID(""),
+	}
+
+	for n, err := range cases {
+		if err == nil {
+			t.Errorf("%s: want an error, got nil", n)
+		}
+	}
+
+	if len(config.pool) != 0 {
+		t.Errorf("want the invalid options discarded, got %d options", len(config.pool))
+	}
+}
+
+func TestInterceptorMark(t *testing.T) {
+	l := &Livereload{webserviceInjectable: "<script></script>", readAll: io.ReadAll}
+
+	cases := map[string]struct {
+		content  string
+		expected bool
+	}{
+		"page":  {"<html><body></body></html>", true},
+		"empty": {"", false},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			r := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(c.content))}
+
+			err := l.Handler()(r)
+			if err != nil {
+				t.Fatalf("want error nil, got '%v'", err)
+			}
+
+			if got := interceptor.Marked(r, Mark); got != c.expected {
+				t.Errorf("want marked %v, got %v", c.expected, got)
+			}
+		})
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		r := &http.Response{Header: http.Header{}}
+
+		l.Transformer()(r, strings.NewReader("<html><body></body></html>"))
+
+		if !interceptor.Marked(r, Mark) {
+			t.Errorf("want marked, got unmarked")
+		}
+	})
+}
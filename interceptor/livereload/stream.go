@@ -0,0 +1,142 @@
+package livereload
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// injector is an [io.Reader] that injects the snippet in an html page while it is read.
+//
+// It looks for the same injection point than [livereload.injectionPoint], but without loading the page whole in memory.
+// As the last closing body element can't be known until the page ends, the content since each candidate element
+// is held until other candidate is found or the page ends. Usually it is only the end of the page, as `</body></html>`.
+// For [livereload.HeadEnd], the snippet is injected before the first closing head element or opening body element.
+type injector struct {
+	tokenizer *html.Tokenizer
+	snippet   []byte
+	position  Position
+
+	// out stores the content ready to be read.
+	out bytes.Buffer
+
+	// held stores the content since the candidate element found, pending to know if the snippet is injected before it.
+	held bytes.Buffer
+
+	// holding is the candidate element that started the held content, or zero if there isn't.
+	holding atom.Atom
+
+	// scratch stores the copy of the raw content of the last tag.
+	scratch []byte
+
+	// empty is true while the page doesn't have content. The empty pages aren't modified.
+	empty    bool
+	injected bool
+	err      error
+}
+
+// newInjector returns an [livereload.injector] that reads the page from the reader passed.
+func newInjector(r io.Reader, snippet []byte, position Position) *injector {
+	return &injector{
+		tokenizer: html.NewTokenizer(r),
+		snippet:   snippet,
+		position:  position,
+		empty:     true,
+	}
+}
+
+// Read implements [io.Reader] interface.
+func (i *injector) Read(p []byte) (int, error) {
+	for i.out.Len() == 0 && i.err == nil {
+		i.next()
+	}
+
+	if i.out.Len() == 0 {
+		return 0, i.err
+	}
+
+	return i.out.Read(p)
+}
+
+// next tokenizes the next element of the page and moves its content to the output or to the held content.
+func (i *injector) next() {
+	t := i.tokenizer.Next()
+
+	raw := i.tokenizer.Raw()
+	if t == html.StartTagToken || t == html.EndTagToken {
+		// the raw content is copied, because the tokenizer lowers the case of the tag names in its buffer
+		i.scratch = append(i.scratch[:0], raw...)
+		raw = i.scratch
+	}
+	if len(raw) > 0 {
+		i.empty = false
+	}
+
+	if t == html.ErrorToken {
+		i.write(raw)
+		i.end(i.tokenizer.Err())
+		return
+	}
+
+	if i.injected {
+		i.out.Write(raw)
+		return
+	}
+
+	name, _ := i.tokenizer.TagName()
+	a := atom.Lookup(name)
+
+	switch {
+	case i.position == HeadEnd && (t == html.EndTagToken && a == atom.Head || t == html.StartTagToken && a == atom.Body):
+		i.release()
+		i.out.Write(i.snippet)
+		i.injected = true
+		i.out.Write(raw)
+	case t == html.EndTagToken && a == atom.Body:
+		i.hold(a, raw)
+	case t == html.EndTagToken && a == atom.Html && i.holding != atom.Body:
+		i.hold(a, raw)
+	default:
+		i.write(raw)
+	}
+}
+
+// write moves the content to the held content if there is a candidate element, otherwise to the output.
+func (i *injector) write(raw []byte) {
+	if i.holding != 0 {
+		i.held.Write(raw)
+		return
+	}
+
+	i.out.Write(raw)
+}
+
+// hold releases the content held, and starts to hold the content since the candidate element passed.
+func (i *injector) hold(candidate atom.Atom, raw []byte) {
+	i.release()
+	i.holding = candidate
+	i.held.Write(raw)
+}
+
+// release moves the content held to the output, because the snippet isn't injected before it.
+func (i *injector) release() {
+	i.out.Write(i.held.Bytes())
+	i.held.Reset()
+	i.holding = 0
+}
+
+// end injects the snippet before the content held, or at the end of the page if there isn't content held.
+//
+// Receives the error that ended the reading, that is [io.EOF] when the page is read completely.
+// With any other error, the content held is released without the snippet.
+func (i *injector) end(err error) {
+	if err == io.EOF && !i.injected && !i.empty {
+		i.out.Write(i.snippet)
+		i.injected = true
+	}
+
+	i.release()
+	i.err = err
+}
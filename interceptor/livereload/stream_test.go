@@ -0,0 +1,153 @@
+package livereload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// buffered returns the page injected by the handler, to compare it with the transformer.
+func buffered(t testing.TB, l *Livereload, page string) string {
+	t.Helper()
+
+	r := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(page))}
+
+	err := l.Handler()(r)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	return string(content)
+}
+
+func TestTransformer(t *testing.T) {
+	pages := map[string]string{
+		"body":                 "<html><body>a</body></html>",
+		"body in code block":   "<html><body><pre><code>&lt;body&gt;</code></pre></body></html>",
+		"body in script":       "<html><body><script>document.write('</body>')</script>a</body></html>",
+		"body in comment":      "<html><body>a<!-- </body> --></body></html>",
+		"body in textarea":     "<html><body><textarea><body></body></textarea></body></html>",
+		"two body elements":    "<html><body><body>a</body></body></html>",
+		"body after html":      "<html><body>a</html></body>\n",
+		"two html elements":    "<html><body>a</html>b</html>c",
+		"body upper case":      "<HTML><BODY>a</BODY></HTML>",
+		"without body end":     "<html><body>a</html>",
+		"fragment":             "<p>a</p>",
+		"truncated":            "<html><body>a</body></ht",
+		"head":                 "<html><head><title>a</title></head><body></body></html>",
+		"head in style":        "<html><head><style>/* </head> */</style></head><body></body></html>",
+		"without head end":     "<html><head><title>a</title><body>a</body></html>",
+		"without head or body": "<html>a</html>",
+		"empty":                "",
+	}
+
+	for _, position := range []Position{BodyEnd, HeadEnd} {
+		l := &Livereload{
+			webserviceInjectable: "<script>reload()</script>",
+			readAll:              io.ReadAll,
+			position:             position,
+		}
+
+		for n, page := range pages {
+			page := page
+			t.Run(fmt.Sprintf("%s %s", position, n), func(t *testing.T) {
+				r := &http.Response{Header: http.Header{}}
+
+				// reads one byte each time, so the elements are split between many reads
+				content, err := io.ReadAll(l.Transformer()(r, iotest.OneByteReader(strings.NewReader(page))))
+				if err != nil {
+					t.Fatalf("expected error nil, got '%v'", err)
+				}
+
+				if want := buffered(t, l, page); string(content) != want {
+					t.Errorf("expected '%s', got '%s'", want, content)
+				}
+			})
+		}
+	}
+
+	t.Run("read error", func(t *testing.T) {
+		l := &Livereload{webserviceInjectable: "<script>reload()</script>"}
+		failure := errors.New("connection lost")
+
+		reader := io.MultiReader(strings.NewReader("<html><body>a</body>"), iotest.ErrReader(failure))
+
+		content, err := io.ReadAll(l.Transformer()(&http.Response{}, reader))
+		if !errors.Is(err, failure) {
+			t.Errorf("expected error '%v', got '%v'", failure, err)
+		}
+
+		if want := "<html><body>a</body>"; string(content) != want {
+			t.Errorf("expected '%s', got '%s'", want, content)
+		}
+	})
+}
+
+// page returns an html page of the size passed approximately, similar to the pages of the standard library.
+func page(size int) []byte {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("<!DOCTYPE html><html><head><title>pkg</title><style>body { margin: 0 }</style></head><body>")
+
+	for i := 0; buffer.Len() < size; i++ {
+		fmt.Fprintf(buffer, "<div class=\"Documentation-function\"><h4 id=\"F%d\">func F%d</h4>", i, i)
+		fmt.Fprintf(buffer, "<pre><code>func F%d(w io.Writer, body []byte) (int, error)</code></pre>", i)
+		buffer.WriteString("<p>F writes the body to w, and returns the number of bytes written.</p></div>\n")
+	}
+
+	buffer.WriteString("<script>init()</script></body></html>")
+	return buffer.Bytes()
+}
+
+func BenchmarkInjection(b *testing.B) {
+	l := &Livereload{
+		webserviceInjectable: "<script>reload()</script>",
+		readAll:              io.ReadAll,
+	}
+
+	for _, size := range []int{64 << 10, 4 << 20} {
+		content := page(size)
+
+		b.Run(fmt.Sprintf("handler %dKB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(content)))
+
+			for n := 0; n < b.N; n++ {
+				r := &http.Response{Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(content))}
+
+				err := l.Handler()(r)
+				if err != nil {
+					b.Fatalf("expected error nil, got '%v'", err)
+				}
+
+				_, err = io.Copy(io.Discard, r.Body)
+				if err != nil {
+					b.Fatalf("expected error nil, got '%v'", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("transformer %dKB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(content)))
+
+			for n := 0; n < b.N; n++ {
+				r := &http.Response{Header: http.Header{}}
+
+				_, err := io.Copy(io.Discard, l.Transformer()(r, bytes.NewReader(content)))
+				if err != nil {
+					b.Fatalf("expected error nil, got '%v'", err)
+				}
+			}
+		})
+	}
+}
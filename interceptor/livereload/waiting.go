@@ -0,0 +1,71 @@
+package livereload
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// waitingPage is the page sent to the browsers while the origin is unavailable.
+//
+//go:embed waiting.html
+var waitingPage string
+
+// waiting is the template of the waiting page, rendered with the error of the origin and the seconds to retry.
+var waiting = template.Must(template.New("waiting").Parse(waitingPage))
+
+// Waiting renders the page sent to the browsers while the origin is unavailable, as while pkgsite restarts,
+// with the signature of the ErrorHandler of [net/http/httputil.ReverseProxy].
+//
+// The page has the snippet injected, so the browser is reloaded when the server notifies it,
+// and it is requested again each reconnect interval if the notification never comes.
+// The requests that aren't navigations, as the scripts or the styles of a page, only receive a 502 status.
+func (l *Livereload) Waiting(response http.ResponseWriter, request *http.Request, err error) {
+	navigation := request.Method == http.MethodGet || request.Method == http.MethodHead
+	if !navigation || !strings.Contains(request.Header.Get("Accept"), "text/html") {
+		http.Error(response, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	retry := int(math.Ceil(l.reconnectInterval.Seconds()))
+	if retry < 1 {
+		retry = 1
+	}
+
+	page := &bytes.Buffer{}
+	_ = waiting.Execute(page, struct {
+		Retry int
+		Error string
+	}{retry, fmt.Sprint(err)})
+
+	header := response.Header()
+
+	snippet, err := l.inject(&http.Response{Header: header, Request: request})
+	if err != nil {
+		// the page is sent without the snippet, it is requested again anyway
+		snippet = ""
+	}
+
+	location := injectionPoint(page.Bytes(), l.position)
+
+	content := page.String()
+	content = content[:location] + snippet + content[location:]
+
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(content)))
+	header.Set("Cache-Control", "no-store")
+	header.Set("Retry-After", strconv.Itoa(retry))
+	response.WriteHeader(http.StatusServiceUnavailable)
+
+	if request.Method == http.MethodHead {
+		return
+	}
+
+	_, _ = io.WriteString(response, content)
+}
@@ -0,0 +1,72 @@
+package livereload
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWaiting(t *testing.T) {
+	cases := map[string]struct {
+		method string
+		accept string
+		status int
+		page   bool
+	}{
+		"navigation": {http.MethodGet, "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusServiceUnavailable, true},
+		"head":       {http.MethodHead, "text/html", http.StatusServiceUnavailable, false},
+		"script":     {http.MethodGet, "*/*", http.StatusBadGateway, false},
+		"post":       {http.MethodPost, "text/html", http.StatusBadGateway, false},
+	}
+
+	l := newClient(t, CSPNone)
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			request := httptest.NewRequest(c.method, "/pkg", nil)
+			request.Header.Set("Accept", c.accept)
+
+			recorder := httptest.NewRecorder()
+			l.Waiting(recorder, request, fmt.Errorf("connection refused"))
+
+			if recorder.Code != c.status {
+				t.Errorf("want status %d, got %d", c.status, recorder.Code)
+			}
+
+			body := recorder.Body.String()
+			if got := strings.Contains(body, `<script src="/__reloader/client.js?v=abc"></script>`); got != c.page {
+				t.Errorf("want the client injected %v, got body '%s'", c.page, body)
+			}
+
+			if !c.page {
+				return
+			}
+
+			if !strings.Contains(body, `<meta http-equiv="refresh" content="2">`) || !strings.Contains(body, "connection refused") {
+				t.Errorf("want the page with the retry and the error, got '%s'", body)
+			}
+
+			if got := recorder.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("want Cache-Control 'no-store', got '%s'", got)
+			}
+
+			if got := recorder.Header().Get("Retry-After"); got != "2" {
+				t.Errorf("want Retry-After '2', got '%s'", got)
+			}
+		})
+	}
+
+	t.Run("nonce", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/pkg", nil)
+		request.Header.Set("Accept", "text/html")
+
+		recorder := httptest.NewRecorder()
+		newClient(t, CSPNonce).Waiting(recorder, request, fmt.Errorf("connection refused"))
+
+		if body := recorder.Body.String(); !strings.Contains(body, ` nonce="`) {
+			t.Errorf("want the client with a nonce, got '%s'", body)
+		}
+	})
+}
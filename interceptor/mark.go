@@ -0,0 +1,52 @@
+package interceptor
+
+import (
+	"context"
+	"net/http"
+)
+
+// marksKey is the key of the context of the request that stores the marks of a response.
+type marksKey struct{}
+
+// Mark records that the interceptor named modified the response,
+// so the interceptors that run later can know it with [interceptor.Marked].
+//
+// The marks are stored in the context of the request of the response, so they aren't sent to the client.
+func Mark(r *http.Response, name string) {
+	if r.Request == nil {
+		r.Request = &http.Request{}
+	}
+
+	r.Request = r.Request.WithContext(withMark(r.Request.Context(), name))
+}
+
+// MarkRequest records that the interceptor named modified the request, before it is sent to the origin.
+// The mark is known by [interceptor.Marked] in the response of the request too.
+//
+// As the request can't be replaced by the request interceptors, its context is replaced in place.
+func MarkRequest(r *http.Request, name string) {
+	*r = *r.WithContext(withMark(r.Context(), name))
+}
+
+// withMark returns a copy of the context with the mark added.
+func withMark(ctx context.Context, name string) context.Context {
+	previous, _ := ctx.Value(marksKey{}).(map[string]bool)
+
+	marks := make(map[string]bool, len(previous)+1)
+	for mark := range previous {
+		marks[mark] = true
+	}
+	marks[name] = true
+
+	return context.WithValue(ctx, marksKey{}, marks)
+}
+
+// Marked returns true if the interceptor named modified the response, as it was recorded by [interceptor.Mark].
+func Marked(r *http.Response, name string) bool {
+	if r.Request == nil {
+		return false
+	}
+
+	marks, _ := r.Request.Context().Value(marksKey{}).(map[string]bool)
+	return marks[name]
+}
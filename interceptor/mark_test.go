@@ -0,0 +1,69 @@
+package interceptor
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMark(t *testing.T) {
+
+	t.Run("without request", func(t *testing.T) {
+		r := &http.Response{}
+
+		if Marked(r, "a") {
+			t.Errorf("expected unmarked, got marked")
+		}
+
+		Mark(r, "a")
+
+		if !Marked(r, "a") {
+			t.Errorf("expected marked, got unmarked")
+		}
+	})
+
+	t.Run("many marks", func(t *testing.T) {
+		r := &http.Response{Request: &http.Request{}}
+
+		Mark(r, "a")
+		Mark(r, "b")
+
+		if !Marked(r, "a") || !Marked(r, "b") {
+			t.Errorf("expected both marks, got a %v and b %v", Marked(r, "a"), Marked(r, "b"))
+		}
+
+		if Marked(r, "c") {
+			t.Errorf("expected c unmarked, got marked")
+		}
+	})
+
+	t.Run("other responses", func(t *testing.T) {
+		request := &http.Request{}
+		r := &http.Response{Request: request}
+		other := &http.Response{Request: request}
+
+		Mark(r, "a")
+
+		if Marked(other, "a") {
+			t.Errorf("expected the other response unmarked, got marked")
+		}
+	})
+}
+
+func TestMarkRequest(t *testing.T) {
+	request := &http.Request{}
+
+	MarkRequest(request, "a")
+
+	// the response of the request, as the reverse proxy receives it
+	r := &http.Response{Request: request.WithContext(request.Context())}
+
+	if !Marked(r, "a") {
+		t.Errorf("expected marked, got unmarked")
+	}
+
+	Mark(r, "b")
+
+	if !Marked(r, "a") || !Marked(r, "b") {
+		t.Errorf("expected both marks, got a %v and b %v", Marked(r, "a"), Marked(r, "b"))
+	}
+}
@@ -0,0 +1,188 @@
+package modules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rules groups the glob patterns evaluated over a module.
+//
+// The patterns support `*` and `?` to match inside a segment, and `**` to match any number of segments.
+type Rules struct {
+
+	// Paths are the patterns evaluated over the module path, as `github.com/myorg/**`.
+	Paths []string `yaml:"paths"`
+
+	// Dirs are the patterns evaluated over the module directory, relative to the root of the discovery.
+	Dirs []string `yaml:"dirs"`
+}
+
+// Filter selects the modules that must be loaded.
+//
+// It is loaded from a yaml file like:
+//
+//	include:
+//	  paths: ["github.com/myorg/**"]
+//	exclude:
+//	  dirs: ["archive/**"]
+//	maxDepth: 3
+type Filter struct {
+
+	// Include are the rules that a module must match to be loaded. If it is empty, all modules match.
+	Include Rules `yaml:"include"`
+
+	// Exclude are the rules that discard a module although it matches the include rules.
+	Exclude Rules `yaml:"exclude"`
+
+	// MaxDepth is the maximum depth of the directories walked, where the children of the root have depth 1.
+	// If it is zero, there is not limit.
+	MaxDepth int `yaml:"maxDepth"`
+
+	include *compiledRules
+	exclude *compiledRules
+}
+
+// compiledRules stores the patterns of a [modules.Rules] translated to regular expressions.
+type compiledRules struct {
+	paths []*regexp.Regexp
+	dirs  []*regexp.Regexp
+}
+
+// ParseFilter returns a [modules.Filter] loaded from the yaml content.
+func ParseFilter(content []byte) (*Filter, error) {
+	filter := &Filter{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	err := decoder.Decode(filter)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse filter: %v", err)
+	}
+
+	if filter.MaxDepth < 0 {
+		return nil, fmt.Errorf("maxDepth cannot be negative")
+	}
+
+	filter.include, err = compileRules(filter.Include)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile include rules: %v", err)
+	}
+
+	filter.exclude, err = compileRules(filter.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile exclude rules: %v", err)
+	}
+
+	return filter, nil
+}
+
+// Match validates if a module must be loaded. dir must be relative to the root of the discovery.
+func (f *Filter) Match(modulePath string, dir string) bool {
+	dir = filepath.ToSlash(dir)
+
+	if !f.include.empty() && !f.include.match(modulePath, dir) {
+		return false
+	}
+
+	return !f.exclude.match(modulePath, dir)
+}
+
+// TooDeep validates if a directory, relative to the root of the discovery, exceeds the maximum depth.
+func (f *Filter) TooDeep(dir string) bool {
+	if f.MaxDepth == 0 || dir == "." {
+		return false
+	}
+
+	return strings.Count(filepath.ToSlash(dir), "/")+1 > f.MaxDepth
+}
+
+// empty validates if there are not patterns.
+func (cr *compiledRules) empty() bool {
+	return len(cr.paths) == 0 && len(cr.dirs) == 0
+}
+
+// match validates if the module path matches any of the path patterns, or the dir any of the dir patterns.
+func (cr *compiledRules) match(modulePath string, dir string) bool {
+	for _, exp := range cr.paths {
+		if exp.MatchString(modulePath) {
+			return true
+		}
+	}
+
+	for _, exp := range cr.dirs {
+		if exp.MatchString(dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compileRules converts the glob patterns of the rules into regular expressions.
+func compileRules(rules Rules) (*compiledRules, error) {
+	paths, err := compilePatterns(rules.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, err := compilePatterns(rules.Dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compiledRules{paths: paths, dirs: dirs}, nil
+}
+
+// compilePatterns converts a list of glob patterns into regular expressions.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	expressions := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		exp, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+		expressions = append(expressions, exp)
+	}
+
+	return expressions, nil
+}
+
+// globToRegexp translates a glob pattern into a regular expression.
+func globToRegexp(pattern string) string {
+	var builder strings.Builder
+
+	pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// `**/` also matches zero segments
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					builder.WriteString("(.*/)?")
+				} else {
+					builder.WriteString(".*")
+				}
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return builder.String()
+}
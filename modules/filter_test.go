@@ -0,0 +1,141 @@
+package modules
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	cases := map[string]struct {
+		content string
+		fail    bool
+	}{
+		"empty":         {"", false},
+		"complete":      {"include:\n  paths: [\"github.com/myorg/**\"]\n  dirs: [\"work/*\"]\nexclude:\n  dirs: [\"archive/**\"]\nmaxDepth: 3\n", false},
+		"unknown field": {"includes:\n  paths: [\"a\"]\n", true},
+		"wrong type":    {"maxDepth: three\n", true},
+		"negative":      {"maxDepth: -1\n", true},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			_, err := ParseFilter([]byte(c.content))
+			if (err != nil) != c.fail {
+				t.Errorf("expected fail %v, got '%v'", c.fail, err)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	filter, err := ParseFilter([]byte(`
+include:
+  paths: ["github.com/myorg/**", "example.com/?"]
+  dirs: ["work/*"]
+exclude:
+  paths: ["**/internal-tools"]
+  dirs: ["**/archive/**"]
+`))
+	if err != nil {
+		t.Fatalf("failed to parse filter: %v", err)
+	}
+
+	cases := map[string]struct {
+		path     string
+		dir      string
+		expected bool
+	}{
+		"include path":         {"github.com/myorg/api", "myorg/api", true},
+		"include nested path":  {"github.com/myorg/api/v2", "myorg/api/v2", true},
+		"include single char":  {"example.com/a", "a", true},
+		"not include":          {"github.com/other/api", "other/api", false},
+		"include dir":          {"github.com/other/api", "work/api", true},
+		"include dir deep":     {"github.com/other/api", "work/api/v2", false},
+		"exclude path":         {"github.com/myorg/internal-tools", "myorg/tools", false},
+		"exclude dir":          {"github.com/myorg/old", "myorg/archive/old", false},
+		"exclude dir in root":  {"github.com/myorg/old", "archive/old", false},
+		"windows separator":    {"github.com/other/api", filepath.Join("work", "api"), true},
+		"single char too long": {"example.com/ab", "ab", false},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			if filter.Match(c.path, c.dir) != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, !c.expected)
+			}
+		})
+	}
+}
+
+func TestFilterTooDeep(t *testing.T) {
+	filter, err := ParseFilter([]byte("maxDepth: 2\n"))
+	if err != nil {
+		t.Fatalf("failed to parse filter: %v", err)
+	}
+
+	cases := map[string]bool{
+		".":     false,
+		"a":     false,
+		"a/b":   false,
+		"a/b/c": true,
+	}
+
+	for dir, expected := range cases {
+		if filter.TooDeep(dir) != expected {
+			t.Errorf("expected %v for %s, got %v", expected, dir, !expected)
+		}
+	}
+}
+
+func TestDiscoverFiltered(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"myorg/api/go.mod":   "module github.com/myorg/api\n",
+		"myorg/web/go.mod":   "module github.com/myorg/web\n",
+		"myorg/a/b/c/go.mod": "module github.com/myorg/deep\n",
+		"other/go.mod":       "module github.com/other/lib\n",
+		"config/modules.yml": "include:\n  paths: [\"github.com/myorg/**\"]\nexclude:\n  dirs: [\"myorg/web\"]\nmaxDepth: 3\n",
+		"config/broken.yml":  "maxDepth: -1\n",
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		d, err := New(func(c Configurer) error {
+			err := c.Root(root)
+			if err != nil {
+				return err
+			}
+			return c.FilterFile(filepath.Join(root, "config", "modules.yml"))
+		})
+		if err != nil {
+			t.Fatalf("failed to instance the discoverer: %v", err)
+		}
+
+		modules, err := d.Discover()
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		expected := []Module{{"github.com/myorg/api", filepath.Join(root, "myorg", "api")}}
+		if fmt.Sprint(expected) != fmt.Sprint(modules) {
+			t.Errorf("expected %v, got %v", expected, modules)
+		}
+	})
+
+	t.Run("broken", func(t *testing.T) {
+		d, err := New(func(c Configurer) error {
+			err := c.Root(root)
+			if err != nil {
+				return err
+			}
+			return c.FilterFile(filepath.Join(root, "config", "broken.yml"))
+		})
+		if err != nil {
+			t.Fatalf("failed to instance the discoverer: %v", err)
+		}
+
+		_, err = d.Discover()
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
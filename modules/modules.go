@@ -0,0 +1,354 @@
+// Package modules discovers the go modules stored in a directory tree.
+//
+// It walks the tree looking for `go.mod` files, includes the nested modules,
+// and honours the `use` directives of the `go.work` files found.
+// Optionally, the modules found are selected by a [modules.Filter] loaded from a yaml file.
+package modules
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Module describes a go module found.
+type Module struct {
+
+	// Path is the module path declared in the go.mod file.
+	Path string
+
+	// Dir is the directory that contains the go.mod file.
+	Dir string
+}
+
+// Discoverer walks a directory tree to find the go modules that it contains.
+type Discoverer struct {
+
+	// root is the directory where the search starts.
+	root string
+
+	// filterPath is the path to the yaml file with the [modules.Filter] to apply. It is read in each discovery.
+	filterPath string
+
+	// readFile allows access to the content of go.mod, go.work and filter files.
+	readFile func(name string) ([]byte, error)
+}
+
+// Root returns the directory where the search starts.
+func (d *Discoverer) Root() string {
+	return d.root
+}
+
+// FilterPath returns the path to the filter file, or empty if it isn't configured.
+func (d *Discoverer) FilterPath() string {
+	return d.filterPath
+}
+
+// Discover walks the tree and returns the modules found sorted by directory.
+//
+// The directories `vendor`, `testdata` and the hidden ones are skipped.
+// The modules referenced by a go.work file are included although they are outside of the tree.
+// If a filter file is configured, it is loaded and only the modules that match it are returned.
+func (d *Discoverer) Discover() ([]Module, error) {
+
+	filter, err := d.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]Module)
+
+	err = filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == d.root {
+				return err
+			}
+			log.Printf("failed to access to %s, skipping it: %v", path, err)
+			return nil
+		}
+
+		if entry.IsDir() {
+			if path != d.root && skipDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+			if filter.TooDeep(d.relative(path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch entry.Name() {
+		case "go.mod":
+			{
+				module, err := d.module(filepath.Dir(path))
+				if err != nil {
+					log.Printf("skipping module: %v", err)
+					return nil
+				}
+				found[module.Dir] = module
+			}
+		case "go.work":
+			{
+				modules, err := d.workspace(path)
+				if err != nil {
+					log.Printf("skipping workspace: %v", err)
+					return nil
+				}
+				for _, module := range modules {
+					found[module.Dir] = module
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %v", d.root, err)
+	}
+
+	modules := make([]Module, 0, len(found))
+	for _, module := range found {
+		if !filter.Match(module.Path, d.relative(module.Dir)) {
+			continue
+		}
+		modules = append(modules, module)
+	}
+
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Dir < modules[j].Dir
+	})
+
+	return modules, nil
+}
+
+// filter loads the filter file configured. If there isn't one, returns a filter that matches all modules.
+func (d *Discoverer) filter() (*Filter, error) {
+	if len(d.filterPath) == 0 {
+		return ParseFilter(nil)
+	}
+
+	content, err := d.readFile(d.filterPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter %s: %v", d.filterPath, err)
+	}
+
+	filter, err := ParseFilter(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load filter %s: %v", d.filterPath, err)
+	}
+
+	return filter, nil
+}
+
+// relative returns the path relative to the root, or the path itself if it can't be relative.
+func (d *Discoverer) relative(path string) string {
+	rel, err := filepath.Rel(d.root, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// module reads the go.mod file stored in dir.
+func (d *Discoverer) module(dir string) (Module, error) {
+	path := filepath.Join(dir, "go.mod")
+
+	content, err := d.readFile(path)
+	if err != nil {
+		return Module{}, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	modulePath := modfile.ModulePath(content)
+	if len(modulePath) == 0 {
+		return Module{}, fmt.Errorf("%s doesn't declare a module path", path)
+	}
+
+	return Module{Path: modulePath, Dir: dir}, nil
+}
+
+// workspace reads a go.work file and returns the modules referenced by its `use` directives.
+func (d *Discoverer) workspace(path string) ([]Module, error) {
+	content, err := d.readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	work, err := modfile.ParseWork(path, content, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	modules := make([]Module, 0, len(work.Use))
+
+	for _, use := range work.Use {
+		dir := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(path), dir)
+		}
+
+		module, err := d.module(filepath.Clean(dir))
+		if err != nil {
+			log.Printf("skipping module used by %s: %v", path, err)
+			continue
+		}
+
+		modules = append(modules, module)
+	}
+
+	return modules, nil
+}
+
+// skipDir validates if a directory must be ignored by its name.
+func skipDir(name string) bool {
+	switch name {
+	case "vendor", "testdata":
+		return true
+	}
+
+	return strings.HasPrefix(name, ".")
+}
+
+// Dirs returns the directories of the modules passed.
+func Dirs(modules []Module) []string {
+	dirs := make([]string, 0, len(modules))
+	for _, module := range modules {
+		dirs = append(dirs, module.Dir)
+	}
+	return dirs
+}
+
+// Owner returns the module that contains the file passed.
+//
+// If the modules are nested, the innermost module is returned.
+// The second value is false if the file isn't inside of any module.
+func Owner(modules []Module, path string) (Module, bool) {
+	var owner Module
+	found := false
+
+	for _, module := range modules {
+		rel, err := filepath.Rel(module.Dir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if !found || len(module.Dir) > len(owner.Dir) {
+			owner = module
+			found = true
+		}
+	}
+
+	return owner, found
+}
+
+// Configurer defines the configurable options to build a new instance of [modules.Discoverer].
+type Configurer interface {
+
+	// Root sets the directory where the search starts. A relative path is resolved from the working directory.
+	Root(path string) error
+
+	// FilterFile sets the path to a yaml file with the [modules.Filter] to apply. A relative path is resolved from the working directory.
+	FilterFile(path string) error
+
+	// ReadFile allows replace the function used to read the go.mod, go.work and filter files.
+	ReadFile(readFile func(name string) ([]byte, error)) error
+}
+
+// configurer implements the [modules.Configurer] interface.
+type configurer struct {
+	pool []func(*Discoverer) error
+}
+
+// Root implements [modules.Configurer.Root] method.
+func (c *configurer) Root(path string) error {
+
+	if len(path) == 0 {
+		return fmt.Errorf("root path cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(d *Discoverer) error {
+		// the watcher reports absolute paths, so the modules must be found with absolute directories
+		root, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the root path %s: %v", path, err)
+		}
+
+		d.root = root
+		return nil
+	})
+
+	return nil
+}
+
+// FilterFile implements [modules.Configurer.FilterFile] method.
+func (c *configurer) FilterFile(path string) error {
+
+	if len(path) == 0 {
+		return fmt.Errorf("filter path cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(d *Discoverer) error {
+		filterPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the filter path %s: %v", path, err)
+		}
+
+		d.filterPath = filterPath
+		return nil
+	})
+
+	return nil
+}
+
+// ReadFile implements [modules.Configurer.ReadFile] method.
+func (c *configurer) ReadFile(readFile func(name string) ([]byte, error)) error {
+
+	if readFile == nil {
+		return fmt.Errorf("read file action cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(d *Discoverer) error {
+		d.readFile = readFile
+		return nil
+	})
+
+	return nil
+}
+
+// New returns a new [modules.Discoverer] instance configured.
+//
+// Receives a list of options callback with the configurations to apply.
+// By default, the files are read with [os.ReadFile].
+func New(options ...func(Configurer) error) (*Discoverer, error) {
+
+	configurer := &configurer{}
+
+	for _, option := range options {
+		err := option(configurer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load options: %v", err)
+		}
+	}
+
+	discoverer := &Discoverer{
+		readFile: os.ReadFile,
+	}
+
+	for _, config := range configurer.pool {
+		err := config(discoverer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply options: %v", err)
+		}
+	}
+
+	if len(discoverer.root) == 0 {
+		return nil, fmt.Errorf("root is required")
+	}
+
+	return discoverer, nil
+}
@@ -0,0 +1,185 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree creates the files passed, indexed by their relative path, under a temporary root.
+func writeTree(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+
+		err = os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	return root
+}
+
+func TestNew(t *testing.T) {
+
+	t.Run("without root", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("root empty", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.Root("")
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("read file nil", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.ReadFile(nil)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"project-1/go.mod":                    "module example.com/project1\n",
+		"project-1/main.go":                   "package main\n",
+		"project-1/tools/go.mod":              "module example.com/project1/tools\n",
+		"project-1/vendor/example.com/go.mod": "module example.com/vendored\n",
+		"project-1/testdata/go.mod":           "module example.com/testdata\n",
+		".cache/go.mod":                       "module example.com/hidden\n",
+		"deep/a/b/c/go.mod":                   "module example.com/deep\n",
+		"broken/go.mod":                       "go 1.19\n",
+		"workspace/go.work":                   "go 1.19\n\nuse (\n\t./api\n\t../outside\n\t./missing\n)\n",
+		"workspace/api/go.mod":                "module example.com/api\n",
+		"outside/go.mod":                      "module example.com/outside\n",
+	})
+
+	d, err := New(func(c Configurer) error {
+		return c.Root(root)
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the discoverer: %v", err)
+	}
+
+	modules, err := d.Discover()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	expected := []Module{
+		{"example.com/deep", filepath.Join(root, "deep", "a", "b", "c")},
+		{"example.com/outside", filepath.Join(root, "outside")},
+		{"example.com/project1", filepath.Join(root, "project-1")},
+		{"example.com/project1/tools", filepath.Join(root, "project-1", "tools")},
+		{"example.com/api", filepath.Join(root, "workspace", "api")},
+	}
+
+	if fmt.Sprint(expected) != fmt.Sprint(modules) {
+		t.Errorf("expected %v, got %v", expected, modules)
+	}
+}
+
+func TestDiscoverRootMissing(t *testing.T) {
+	d, err := New(func(c Configurer) error {
+		return c.Root(filepath.Join(t.TempDir(), "missing"))
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the discoverer: %v", err)
+	}
+
+	_, err = d.Discover()
+	if err == nil {
+		t.Errorf("expected an error, got error nil")
+	}
+}
+
+func TestDirs(t *testing.T) {
+	dirs := Dirs([]Module{{"a", "/go/src/a"}, {"b", "/go/src/b"}})
+
+	expected := "[/go/src/a /go/src/b]"
+	if fmt.Sprint(dirs) != expected {
+		t.Errorf("expected %s, got %v", expected, dirs)
+	}
+}
+
+func TestOwner(t *testing.T) {
+	found := []Module{{"a", "/go/src/a"}, {"a/nested", "/go/src/a/nested"}, {"ab", "/go/src/ab"}}
+
+	cases := map[string]struct {
+		path     string
+		expected string
+		ok       bool
+	}{
+		"root":       {"/go/src/a/a.go", "a", true},
+		"nested":     {"/go/src/a/nested/pkg/b.go", "a/nested", true},
+		"same start": {"/go/src/ab/ab.go", "ab", true},
+		"outside":    {"/go/src/c/c.go", "", false},
+		"module dir": {"/go/src/a", "a", true},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			owner, ok := Owner(found, tc.path)
+			if ok != tc.ok || owner.Path != tc.expected {
+				t.Errorf("expected %s %v, got %s %v", tc.expected, tc.ok, owner.Path, ok)
+			}
+		})
+	}
+}
+
+func TestOwnerRelativeRoot(t *testing.T) {
+	root, err := filepath.EvalSymlinks(writeTree(t, map[string]string{
+		"project/go.mod":  "module example.com/project\n",
+		"project/main.go": "package main\n",
+	}))
+	if err != nil {
+		t.Fatalf("failed to resolve the root: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get the working directory: %v", err)
+	}
+	err = os.Chdir(root)
+	if err != nil {
+		t.Fatalf("failed to change the working directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	d, err := New(func(c Configurer) error {
+		return c.Root(".")
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the discoverer: %v", err)
+	}
+
+	found, err := d.Discover()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	// the watcher reports the files changed with absolute paths
+	owner, ok := Owner(found, filepath.Join(root, "project", "main.go"))
+	if !ok || owner.Path != "example.com/project" {
+		t.Errorf("expected example.com/project true, got %s %v", owner.Path, ok)
+	}
+}
@@ -0,0 +1,229 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// encoded stores the original content of a response decoded,
+// to restore it if the interceptors don't modify the body.
+type encoded struct {
+
+	// encoding is the value of the Content-Encoding header, as `gzip`, `deflate` or `br`.
+	encoding string
+
+	// length is the Content-Length header as it was received from the origin, empty if it was unknown.
+	length string
+
+	// original is the body as it was received from the origin, without the bytes read to build the decoder.
+	original io.ReadCloser
+
+	// source records the bytes read from the original body until the content decoded is read.
+	source *recorder
+
+	// body is the body decoded set to the response. If it is replaced or read, the content was modified.
+	body *decoded
+}
+
+// recorder reads from a reader and records the bytes read, until it is stopped.
+type recorder struct {
+	io.Reader
+	read *bytes.Buffer
+}
+
+// Read implements [io.Reader] interface.
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if r.read != nil {
+		r.read.Write(p[:n])
+	}
+	return n, err
+}
+
+// decoded is the body of a response decoded while it is read.
+type decoded struct {
+	io.Reader
+	closer io.Closer
+
+	// started is true once the content decoded is read, so the original content can't be restored.
+	started bool
+
+	// stop is called the first time the content is read.
+	stop func()
+}
+
+// Read implements [io.Reader] interface.
+func (d *decoded) Read(p []byte) (int, error) {
+	if !d.started {
+		d.started = true
+		d.stop()
+	}
+	return d.Reader.Read(p)
+}
+
+// Close implements [io.Closer] interface. It closes the original body.
+func (d *decoded) Close() error {
+	return d.closer.Close()
+}
+
+// decode replaces the body of a response compressed by a reader that decodes its content while it is read,
+// and removes the Content-Encoding header, so the interceptors can read the content as it is.
+//
+// Only the bytes needed to check the header of the encoding are read in advance, the rest of the content
+// is decoded as it is read, so it is never loaded whole in memory.
+//
+// Returns nil if the response isn't compressed or its body is empty. The encodings supported are gzip, deflate and br.
+func decode(r *http.Response) (*encoded, error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	decoder, ok := decoders[encoding]
+	if !ok {
+		return nil, fmt.Errorf("content encoding '%s' not supported", encoding)
+	}
+
+	if r.ContentLength == 0 {
+		return nil, nil
+	}
+
+	original := &encoded{
+		encoding: encoding,
+		length:   r.Header.Get("Content-Length"),
+		original: r.Body,
+		source:   &recorder{Reader: r.Body, read: &bytes.Buffer{}},
+	}
+
+	reader, err := decoder(original.source)
+	if err != nil {
+		empty := errors.Is(err, io.EOF) && original.source.read.Len() == 0
+		original.restore(r)
+		if empty {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to decode %s content: %v", encoding, err)
+	}
+
+	original.body = &decoded{
+		Reader: reader,
+		closer: r.Body,
+		stop: func() {
+			original.source.read = nil
+		},
+	}
+
+	r.Body = original.body
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+
+	return original, nil
+}
+
+// encode compresses again the body of the response if some interceptor modified it,
+// otherwise the original content is restored.
+//
+// The body is compressed while it is sent, through a pipe, so it is never loaded whole in memory.
+// If the content can't be read or compressed, the error is returned by the body to the client.
+func (e *encoded) encode(r *http.Response) {
+	if r.Body == e.body && !e.body.started {
+		e.restore(r)
+		return
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+
+	body := r.Body
+	reader, writer := io.Pipe()
+
+	go func() {
+		w := encoders[e.encoding](writer)
+
+		_, err := io.Copy(w, body)
+		if err == nil {
+			err = w.Close()
+		}
+
+		_ = body.Close()
+		writer.CloseWithError(err)
+	}()
+
+	r.Body = reader
+	r.Header.Set("Content-Encoding", e.encoding)
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+}
+
+// restore sets the original content to the response, including the bytes read to build the decoder.
+func (e *encoded) restore(r *http.Response) {
+	var read []byte
+	if e.source.read != nil {
+		read = e.source.read.Bytes()
+	}
+
+	r.Body = &transformed{
+		Reader: io.MultiReader(bytes.NewReader(read), e.original),
+		Closer: e.original,
+	}
+	r.Header.Set("Content-Encoding", e.encoding)
+
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+	if length, err := strconv.ParseInt(e.length, 10, 64); err == nil {
+		r.ContentLength = length
+		r.Header.Set("Content-Length", e.length)
+	}
+}
+
+// decoders indexes the functions that return a reader of the content decompressed by their encoding.
+// They fail if the header of the content doesn't match the encoding.
+var decoders = map[string]func(io.Reader) (io.Reader, error){
+	"gzip": func(content io.Reader) (io.Reader, error) {
+		return gzip.NewReader(content)
+	},
+	"deflate": func(content io.Reader) (io.Reader, error) {
+		// the deflate encoding should be wrapped by zlib, but some servers send the raw stream,
+		// so the bytes read to check the zlib header are read again as raw stream
+		header := &recorder{Reader: content, read: &bytes.Buffer{}}
+
+		reader, err := zlib.NewReader(header)
+		if err != nil {
+			if header.read.Len() == 0 {
+				return nil, err
+			}
+			return flate.NewReader(io.MultiReader(header.read, content)), nil
+		}
+
+		header.read = nil
+		return reader, nil
+	},
+	"br": func(content io.Reader) (io.Reader, error) {
+		return brotli.NewReader(content), nil
+	},
+}
+
+// encoders indexes the functions that return a writer that compresses the content by their encoding.
+var encoders = map[string]func(io.Writer) io.WriteCloser{
+	"gzip": func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	},
+	"deflate": func(w io.Writer) io.WriteCloser {
+		return zlib.NewWriter(w)
+	},
+	"br": func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriter(w)
+	},
+}
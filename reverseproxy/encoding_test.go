@@ -0,0 +1,383 @@
+package reverseproxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mauroalderete/pkgsite-local-live/interceptor"
+)
+
+const page = "<html><body><h1>pkgsite</h1></body></html>"
+
+// compressed returns the content compressed with the encoding passed.
+func compressed(t testing.TB, encoding string, content []byte) []byte {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+
+	w := encoders[encoding](buffer)
+	_, err := w.Write(content)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	return buffer.Bytes()
+}
+
+// decompressed returns the content decompressed with the encoding passed.
+func decompressed(t testing.TB, encoding string, content []byte) []byte {
+	t.Helper()
+
+	reader, err := decoders[encoding](bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	return plain
+}
+
+// origin returns a server that responds the page compressed with the encoding passed.
+func origin(t testing.TB, encoding string, content []byte) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		_, _ = w.Write(content)
+	}))
+}
+
+// proxy returns a server that runs a reverse proxy to the origin with the interceptor passed.
+func proxy(t *testing.T, origin string, i interceptor.Interceptor) *httptest.Server {
+	t.Helper()
+
+	rp, err := New(func(c Configurer) error {
+		err := c.Origin(origin)
+		if err != nil {
+			return err
+		}
+		err = c.Public("http://localhost:9090")
+		if err != nil {
+			return err
+		}
+		return c.AddInterceptor("fake", 0, i)
+	})
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = rp.ServeHTTP(w, r)
+	}))
+}
+
+// get requests the url without the transparent decoding of the client, and returns the response and its body.
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+	request.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	return response, body
+}
+
+// appender returns an interceptor that adds the text at the end of the body.
+func appender(text string) *interceptorFake {
+	return &interceptorFake{
+		handler: func(r *http.Response) error {
+			content, err := io.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+			content = append(content, text...)
+			r.Body = io.NopCloser(bytes.NewReader(content))
+			r.ContentLength = int64(len(content))
+			r.Header.Set("Content-Length", strconv.Itoa(len(content)))
+			return nil
+		},
+	}
+}
+
+func TestCompressedResponses(t *testing.T) {
+
+	for _, encoding := range []string{"gzip", "deflate", "br"} {
+		encoding := encoding
+
+		t.Run(encoding+" modified", func(t *testing.T) {
+			content := compressed(t, encoding, []byte(page))
+
+			var received string
+			fake := appender("<!-- injected -->")
+			handler := fake.handler
+			fake.handler = func(r *http.Response) error {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					return err
+				}
+				received = string(body)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				return handler(r)
+			}
+
+			o := origin(t, encoding, content)
+			defer o.Close()
+			p := proxy(t, o.URL, fake)
+			defer p.Close()
+
+			response, body := get(t, p.URL)
+
+			if received != page {
+				t.Errorf("expected the interceptor receives the page decoded, got '%s'", received)
+			}
+
+			if got := response.Header.Get("Content-Encoding"); got != encoding {
+				t.Errorf("expected Content-Encoding '%s', got '%s'", encoding, got)
+			}
+
+			plain := decompressed(t, encoding, body)
+
+			if want := page + "<!-- injected -->"; string(plain) != want {
+				t.Errorf("expected body '%s', got '%s'", want, plain)
+			}
+		})
+
+		t.Run(encoding+" unmodified", func(t *testing.T) {
+			content := compressed(t, encoding, []byte(page))
+
+			o := origin(t, encoding, content)
+			defer o.Close()
+			p := proxy(t, o.URL, &interceptorFake{handler: func(r *http.Response) error { return nil }})
+			defer p.Close()
+
+			response, body := get(t, p.URL)
+
+			if got := response.Header.Get("Content-Encoding"); got != encoding {
+				t.Errorf("expected Content-Encoding '%s', got '%s'", encoding, got)
+			}
+
+			if !bytes.Equal(body, content) {
+				t.Errorf("expected the original content, got '%v'", body)
+			}
+		})
+
+		t.Run(encoding+" rejected", func(t *testing.T) {
+			content := compressed(t, encoding, []byte(page))
+
+			o := origin(t, encoding, content)
+			defer o.Close()
+			p := proxy(t, o.URL, &interceptorFake{
+				rules: []interceptor.InterceptorRuler{func(r *http.Response) bool {
+					if r.Header.Get("Content-Encoding") != encoding {
+						t.Errorf("expected the rules receive the response encoded, got Content-Encoding '%s'", r.Header.Get("Content-Encoding"))
+					}
+					return false
+				}},
+			})
+			defer p.Close()
+
+			response, body := get(t, p.URL)
+
+			if got := response.Header.Get("Content-Encoding"); got != encoding {
+				t.Errorf("expected Content-Encoding '%s', got '%s'", encoding, got)
+			}
+
+			if response.ContentLength != int64(len(content)) {
+				t.Errorf("expected Content-Length %d, got %d", len(content), response.ContentLength)
+			}
+
+			if !bytes.Equal(body, content) {
+				t.Errorf("expected the original content, got '%v'", body)
+			}
+		})
+	}
+
+	t.Run("raw deflate", func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		writer, _ := flate.NewWriter(buffer, flate.DefaultCompression)
+		_, _ = writer.Write([]byte(page))
+		_ = writer.Close()
+
+		plain := decompressed(t, "deflate", buffer.Bytes())
+
+		if string(plain) != page {
+			t.Errorf("expected body '%s', got '%s'", page, plain)
+		}
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		content := []byte("not gzip content")
+
+		called := false
+		o := origin(t, "gzip", content)
+		defer o.Close()
+		p := proxy(t, o.URL, &interceptorFake{handler: func(r *http.Response) error {
+			called = true
+			return nil
+		}})
+		defer p.Close()
+
+		response, body := get(t, p.URL)
+
+		if called {
+			t.Errorf("expected the interceptor is skipped, got it called")
+		}
+
+		if got := response.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("expected Content-Encoding 'gzip', got '%s'", got)
+		}
+
+		if !bytes.Equal(body, content) {
+			t.Errorf("expected the original content, got '%s'", body)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		o := origin(t, "gzip", nil)
+		defer o.Close()
+		p := proxy(t, o.URL, appender("<!-- injected -->"))
+		defer p.Close()
+
+		_, body := get(t, p.URL)
+
+		if want := "<!-- injected -->"; string(body) != want {
+			t.Errorf("expected body '%s', got '%s'", want, body)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		r := &http.Response{
+			Header: http.Header{"Content-Encoding": []string{"zstd"}},
+			Body:   io.NopCloser(strings.NewReader(page)),
+		}
+
+		_, err := decode(r)
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		o := origin(t, "", []byte(page))
+		defer o.Close()
+		p := proxy(t, o.URL, appender("<!-- injected -->"))
+		defer p.Close()
+
+		response, body := get(t, p.URL)
+
+		if got := response.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("expected Content-Encoding empty, got '%s'", got)
+		}
+
+		if want := page + "<!-- injected -->"; string(body) != want {
+			t.Errorf("expected body '%s', got '%s'", want, body)
+		}
+	})
+}
+
+// discard is a [http.ResponseWriter] that drops the content, so the benchmarks measure only the proxy.
+type discard struct {
+	header http.Header
+}
+
+func (d *discard) Header() http.Header {
+	return d.header
+}
+
+func (d *discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (d *discard) WriteHeader(int) {}
+
+// large returns an html page of the size passed approximately.
+func large(size int) []byte {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("<!DOCTYPE html><html><head><title>pkg</title></head><body>")
+
+	for i := 0; buffer.Len() < size; i++ {
+		fmt.Fprintf(buffer, "<div><h4 id=\"F%d\">func F%d</h4><pre><code>func F%d(w io.Writer) error</code></pre></div>\n", i, i, i)
+	}
+
+	buffer.WriteString("</body></html>")
+	return buffer.Bytes()
+}
+
+func BenchmarkCompressedStream(b *testing.B) {
+
+	// appends a comment to the content while it is read, as livereload injects the snippet
+	stream := &streamInterceptorFake{
+		transformer: func(r *http.Response, body io.Reader) io.Reader {
+			return io.MultiReader(body, strings.NewReader("<!-- injected -->"))
+		},
+	}
+
+	for _, size := range []int{64 << 10, 4 << 20} {
+		plain := large(size)
+		content := compressed(b, "gzip", plain)
+
+		o := origin(b, "gzip", content)
+		defer o.Close()
+
+		rp, err := New(func(c Configurer) error {
+			err := c.Origin(o.URL)
+			if err != nil {
+				return err
+			}
+			err = c.Public("http://localhost:9090")
+			if err != nil {
+				return err
+			}
+			return c.AddInterceptor("stream", 0, stream)
+		})
+		if err != nil {
+			b.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		b.Run(fmt.Sprintf("gzip %dKB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(plain)))
+
+			for n := 0; n < b.N; n++ {
+				request := httptest.NewRequest(http.MethodGet, "/", nil)
+				request.Header.Set("Accept-Encoding", "gzip")
+
+				err := rp.ServeHTTP(&discard{header: http.Header{}}, request)
+				if err != nil {
+					b.Fatalf("expected error nil, got '%v'", err)
+				}
+			}
+		})
+	}
+}
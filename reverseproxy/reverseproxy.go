@@ -2,11 +2,15 @@
 package reverseproxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sort"
 
 	"github.com/mauroalderete/pkgsite-local-live/interceptor"
 )
@@ -23,11 +27,69 @@ type ReverseProxy struct {
 	// proxy is the [httputil.ReverseProxy] instance that is executed.
 	proxy *httputil.ReverseProxy
 
-	// interceptors is a list of the all [interceptor.Interceptor] configured.
-	interceptors map[string]interceptor.Interceptor
+	// interceptors is the chain of the all [interceptor.Interceptor] configured, sorted by priority.
+	interceptors []link[interceptor.Interceptor]
+
+	// requestInterceptors is the chain of the all [interceptor.RequestInterceptor] configured, sorted by priority.
+	requestInterceptors []link[interceptor.RequestInterceptor]
+
+	// errorHandler responds the requests when the origin can't be reached. Without it, a 502 status is sent.
+	errorHandler ErrorHandler
+}
+
+// ErrorHandler defines a function that responds a request when the origin can't be reached, as while it restarts.
+//
+// Receives the [http.ResponseWriter] of the client, the *[http.Request] received and the error of the origin.
+type ErrorHandler func(http.ResponseWriter, *http.Request, error)
+
+// link is an interceptor of a chain, with the name and the priority used to load it.
+type link[T any] struct {
+	name        string
+	priority    int
+	interceptor T
+}
+
+// chain adds the interceptor to the links, keeping them sorted by priority.
+// The links with the same priority keep the order they were added.
+//
+// Returns an error if there is other link with the same name.
+func chain[T any](links []link[T], name string, priority int, interceptor T) ([]link[T], error) {
+	for _, l := range links {
+		if l.name == name {
+			return nil, fmt.Errorf("it already exists an interceptor named %s", name)
+		}
+	}
+
+	links = append(links, link[T]{name: name, priority: priority, interceptor: interceptor})
+
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].priority < links[j].priority
+	})
+
+	return links, nil
 }
 
+// director redirects the request to the origin.
+//
+// As the origin receives its own host, the address used by the client is kept in the X-Forwarded-Host
+// and X-Forwarded-Proto headers, unless a proxy in front of this one already set them.
 func (rp *ReverseProxy) director(request *http.Request) {
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+
+	if request.Header.Get("X-Forwarded-Host") == "" && request.Host != "" {
+		request.Header.Set("X-Forwarded-Host", request.Host)
+	}
+
+	if request.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if request.TLS != nil {
+			proto = "https"
+		}
+		request.Header.Set("X-Forwarded-Proto", proto)
+	}
+
 	request.Host = rp.origin.Host
 	request.URL.Host = rp.origin.Host
 	request.URL.Scheme = rp.origin.Scheme
@@ -35,53 +97,219 @@ func (rp *ReverseProxy) director(request *http.Request) {
 }
 
 // modify iterates for each interceptor and executes his handler if needed.
+//
+// The compressed responses are decoded before the first interceptor that accepts them runs, and encoded again after,
+// so the interceptors always access to the content as it is.
+// If the response can't be decoded, it is sent without running the interceptors.
 func (rp *ReverseProxy) modify(r *http.Response) error {
 
+	original, err := rp.intercept(r)
+	if err != nil {
+		return err
+	}
+
+	if original == nil {
+		return nil
+	}
+
+	original.encode(r)
+
+	return nil
+}
+
+// intercept iterates for each interceptor in the order of the chain and executes his handler if needed.
+//
+// An interceptor whose rules aren't passed is skipped, and the chain continues with the next one.
+// Each interceptor receives the response as the previous ones left it.
+// The [interceptor.StreamInterceptor] wrap the body with their transformer instead of running their handler.
+//
+// The content is decoded only when some interceptor accepts the response, so the compressed responses
+// that no interceptor handles, as scripts, styles or images, are sent byte-for-byte as the origin sent them.
+// Returns the original encoding of the response decoded, or nil if it wasn't decoded.
+func (rp *ReverseProxy) intercept(r *http.Response) (*encoded, error) {
+
+	var original *encoded
+	decoded := false
+
 	// iterates by each interceptor configured to check if the rules are passed.
 	// In this case, executes the correspondent interceptor.
-	for name, interceptor := range rp.interceptors {
-		accepted := true
-		for _, rule := range interceptor.Rules() {
-			if !rule(r) {
-				accepted = false
-				break
+	for _, link := range rp.interceptors {
+		if !accepts(link.interceptor, r) {
+			continue
+		}
+
+		if !decoded {
+			decoded = true
+
+			var err error
+			original, err = decode(r)
+			if err != nil {
+				log.Printf("the interceptors are skipped for %s: %v", r.Request.URL, err)
+				return nil, nil
 			}
 		}
 
-		if !accepted {
-			break
+		if stream, ok := link.interceptor.(interceptor.StreamInterceptor); ok {
+			transform(r, stream.Transformer())
+			continue
 		}
 
-		handler := interceptor.Handler()
+		handler := link.interceptor.Handler()
 		err := handler(r)
 		if err != nil {
-			return fmt.Errorf("interceptor '%s' failed to run: %v", name, err)
+			return nil, &interceptorError{name: link.name, err: err}
 		}
 	}
 
-	return nil
+	return original, nil
+}
+
+// interceptorError is the error of an interceptor that failed to run over the response of the origin.
+// It allows to distinguish these errors from the ones of the origin, because the origin could be reached.
+type interceptorError struct {
+	name string
+	err  error
+}
+
+// Error implements [error] interface.
+func (e *interceptorError) Error() string {
+	return fmt.Sprintf("interceptor '%s' failed to run: %v", e.name, e.err)
+}
+
+// Unwrap returns the error of the interceptor.
+func (e *interceptorError) Unwrap() error {
+	return e.err
+}
+
+// accepts returns true if the response passes all rules of the interceptor.
+func accepts(i interceptor.Interceptor, r *http.Response) bool {
+	for _, rule := range i.Rules() {
+		if !rule(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// transformed is the body of a response wrapped by an [interceptor.InterceptorTransformer].
+// It reads from the transformer and closes the original body.
+type transformed struct {
+	io.Reader
+	io.Closer
+}
+
+// transform wraps the body of the response with the transformer, so the content is modified while it is sent.
+// As the length of the content modified isn't known, the Content-Length header is removed.
+func transform(r *http.Response, transformer interceptor.InterceptorTransformer) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+
+	r.Body = &transformed{
+		Reader: transformer(r, r.Body),
+		Closer: r.Body,
+	}
+	r.ContentLength = -1
+	r.Header.Del("Content-Length")
+}
+
+// interceptRequest iterates for each request interceptor in the order of the chain and executes his handler if needed,
+// before the request is sent to the origin.
+//
+// Returns true if some interceptor wrote the response, in this case the next ones aren't executed.
+func (rp *ReverseProxy) interceptRequest(response http.ResponseWriter, request *http.Request) (bool, error) {
+
+	for _, link := range rp.requestInterceptors {
+		if !acceptsRequest(link.interceptor, request) {
+			continue
+		}
+
+		handler := link.interceptor.Handler()
+		handled, err := handler(response, request)
+		if err != nil {
+			return handled, fmt.Errorf("request interceptor '%s' failed to run: %v", link.name, err)
+		}
+
+		if handled {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// acceptsRequest returns true if the request passes all rules of the interceptor.
+func acceptsRequest(i interceptor.RequestInterceptor, r *http.Request) bool {
+	for _, rule := range i.Rules() {
+		if !rule(r) {
+			return false
+		}
+	}
+
+	return true
 }
 
 // coverage:ignore-start
 
 // Run starts to lisent and serve the reverse proxy
 func (rp *ReverseProxy) Run() error {
-	err := http.ListenAndServe(rp.endpoint.Host, rp.proxy)
+	err := http.ListenAndServe(rp.endpoint.Host, http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		err := rp.ServeHTTP(response, request)
+		if err != nil {
+			log.Printf("reloader proxy failed to serve %s: %v", request.URL, err)
+		}
+	}))
 	if err != nil {
 		return fmt.Errorf("reloader proxy failed: %v", err)
 	}
 	return nil
 }
 
+// coverage:ignore-end
+
 // ServeHTTP implements [http.Handler] interface. It allows execute a request parse manually.
 //
 // Receives the request data that the reverse proxy handle to apply the correspondent redirection.
+// Before, the request interceptors are executed, and if some of them responds the request, it isn't sent to the origin.
+// If a request interceptor fails without responding, the client receives a bad gateway status.
 func (rp *ReverseProxy) ServeHTTP(response http.ResponseWriter, request *http.Request) error {
+	handled, err := rp.interceptRequest(response, request)
+	if err != nil {
+		if !handled {
+			http.Error(response, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		}
+		return err
+	}
+
+	if handled {
+		return nil
+	}
+
 	rp.proxy.ServeHTTP(response, request)
 	return nil
 }
 
-// coverage:ignore-end
+// fail logs the error of the proxy and responds the request.
+//
+// Only the errors reaching the origin are responded by the error handler configured.
+// The errors of the interceptors are responded with a bad gateway status, because the origin is up,
+// and nothing is written if the client cancelled the request.
+func (rp *ReverseProxy) fail(response http.ResponseWriter, request *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	rp.proxy.ErrorLog.Printf("http: proxy error: %v", err)
+
+	var failed *interceptorError
+	if rp.errorHandler == nil || errors.As(err, &failed) {
+		response.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	rp.errorHandler(response, request, err)
+}
 
 // Configurer defines the available options to configure a new instance of [reverseproxy.ReverseProxy].
 type Configurer interface {
@@ -94,8 +322,20 @@ type Configurer interface {
 
 	// AddInterceptor allows loading a new interceptor that the proxy must be execute by each request.
 	//
-	// Receives a name to identify the interceptor loaded.
-	AddInterceptor(name string, interceptor interceptor.Interceptor) error
+	// Receives a name to identify the interceptor loaded, and the priority that sets its position in the chain.
+	// The interceptors with lower priority run first, and those with the same priority run in the order they were loaded.
+	AddInterceptor(name string, priority int, interceptor interceptor.Interceptor) error
+
+	// AddRequestInterceptor allows loading a new interceptor that the proxy must be execute by each request
+	// before sending it to the origin.
+	//
+	// Receives a name to identify the interceptor loaded, and the priority that sets its position in the chain,
+	// with the same criteria of [reverseproxy.Configurer.AddInterceptor].
+	AddRequestInterceptor(name string, priority int, interceptor interceptor.RequestInterceptor) error
+
+	// ErrorHandler allows set the function that responds the requests when the origin can't be reached,
+	// instead of the 502 status sent by default. The errors of the interceptors are always responded with the 502 status.
+	ErrorHandler(handler ErrorHandler) error
 }
 
 // configurerPool implements [reverseproxy.Configurer].
@@ -136,21 +376,61 @@ func (c *configurerPool) Public(address string) error {
 }
 
 // AddInterceptor implements [reverseproxy.Configurer.AddInterceptor] method.
-func (c *configurerPool) AddInterceptor(name string, interceptor interceptor.Interceptor) error {
+func (c *configurerPool) AddInterceptor(name string, priority int, interceptor interceptor.Interceptor) error {
+
+	if interceptor == nil {
+		return fmt.Errorf("failed to load an new interceptor: interceptor %s is nil", name)
+	}
 
 	c.pool = append(c.pool, func(rp *ReverseProxy) error {
 
-		if _, ok := rp.interceptors[name]; ok {
-			return fmt.Errorf("failed to load an new interceptor: it already exists an interceptor named %s", name)
+		interceptors, err := chain(rp.interceptors, name, priority, interceptor)
+		if err != nil {
+			return fmt.Errorf("failed to load an new interceptor: %v", err)
 		}
 
-		rp.interceptors[name] = interceptor
+		rp.interceptors = interceptors
 
 		return nil
 	})
 	return nil
 }
 
+// AddRequestInterceptor implements [reverseproxy.Configurer.AddRequestInterceptor] method.
+func (c *configurerPool) AddRequestInterceptor(name string, priority int, interceptor interceptor.RequestInterceptor) error {
+
+	if interceptor == nil {
+		return fmt.Errorf("failed to load an new request interceptor: interceptor %s is nil", name)
+	}
+
+	c.pool = append(c.pool, func(rp *ReverseProxy) error {
+
+		interceptors, err := chain(rp.requestInterceptors, name, priority, interceptor)
+		if err != nil {
+			return fmt.Errorf("failed to load an new request interceptor: %v", err)
+		}
+
+		rp.requestInterceptors = interceptors
+
+		return nil
+	})
+	return nil
+}
+
+// ErrorHandler implements [reverseproxy.Configurer.ErrorHandler] method.
+func (c *configurerPool) ErrorHandler(handler ErrorHandler) error {
+
+	if handler == nil {
+		return fmt.Errorf("failed to load the error handler: handler is nil")
+	}
+
+	c.pool = append(c.pool, func(rp *ReverseProxy) error {
+		rp.errorHandler = handler
+		return nil
+	})
+	return nil
+}
+
 // New returns a new [reverseproxy.ReverseProxy] instace configured.
 //
 // Receives a list of options callback with the configurations to apply.
@@ -165,13 +445,12 @@ func New(options ...func(Configurer) error) (*ReverseProxy, error) {
 		}
 	}
 
-	proxy := &ReverseProxy{
-		interceptors: make(map[string]interceptor.Interceptor),
-	}
+	proxy := &ReverseProxy{}
 
 	proxy.proxy = &httputil.ReverseProxy{
 		Director:       proxy.director,
 		ModifyResponse: proxy.modify,
+		ErrorHandler:   proxy.fail,
 		ErrorLog:       log.Default(),
 	}
 
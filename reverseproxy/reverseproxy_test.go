@@ -1,9 +1,14 @@
 package reverseproxy
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/mauroalderete/pkgsite-local-live/interceptor"
@@ -77,7 +82,7 @@ func TestNew(t *testing.T) {
 			if err != nil {
 				return err
 			}
-			err = c.AddInterceptor("fake", &interceptorFake{})
+			err = c.AddInterceptor("fake", 0, &interceptorFake{})
 			if err != nil {
 				return err
 			}
@@ -123,12 +128,12 @@ func TestNew(t *testing.T) {
 	t.Run("set interceptor repeated", func(t *testing.T) {
 		_, err := New(func(c Configurer) error {
 
-			err := c.AddInterceptor("fake", &interceptorFake{})
+			err := c.AddInterceptor("fake", 0, &interceptorFake{})
 			if err != nil {
 				return err
 			}
 
-			err = c.AddInterceptor("fake", &interceptorFake{})
+			err = c.AddInterceptor("fake", 0, &interceptorFake{})
 			if err != nil {
 				return err
 			}
@@ -175,8 +180,7 @@ func TestModify(t *testing.T) {
 			return nil
 		}
 
-		rp.interceptors = make(map[string]interceptor.Interceptor)
-		rp.interceptors["a"] = i
+		rp.interceptors = []link[interceptor.Interceptor]{{name: "a", interceptor: i}}
 
 		response := &http.Response{}
 
@@ -200,8 +204,7 @@ func TestModify(t *testing.T) {
 			return nil
 		}
 
-		rp.interceptors = make(map[string]interceptor.Interceptor)
-		rp.interceptors["a"] = i
+		rp.interceptors = []link[interceptor.Interceptor]{{name: "a", interceptor: i}}
 
 		response := &http.Response{}
 
@@ -224,8 +227,7 @@ func TestModify(t *testing.T) {
 			return fmt.Errorf("some was wrong")
 		}
 
-		rp.interceptors = make(map[string]interceptor.Interceptor)
-		rp.interceptors["a"] = i
+		rp.interceptors = []link[interceptor.Interceptor]{{name: "a", interceptor: i}}
 
 		response := &http.Response{}
 
@@ -235,3 +237,662 @@ func TestModify(t *testing.T) {
 		}
 	})
 }
+
+func TestChain(t *testing.T) {
+
+	// recorder returns an interceptor that appends its name to the order when it runs.
+	recorder := func(name string, order *[]string, rules ...interceptor.InterceptorRuler) *interceptorFake {
+		return &interceptorFake{
+			rules: rules,
+			handler: func(*http.Response) error {
+				*order = append(*order, name)
+				return nil
+			},
+		}
+	}
+
+	rejected := func(*http.Response) bool { return false }
+
+	cases := map[string]struct {
+		load func(c Configurer, order *[]string) error
+		want []string
+	}{
+		"by priority": {
+			load: func(c Configurer, order *[]string) error {
+				for _, i := range []struct {
+					name     string
+					priority int
+				}{{"c", 30}, {"a", -10}, {"b", 20}} {
+					err := c.AddInterceptor(i.name, i.priority, recorder(i.name, order))
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: []string{"a", "b", "c"},
+		},
+		"same priority in load order": {
+			load: func(c Configurer, order *[]string) error {
+				for _, name := range []string{"c", "a", "b"} {
+					err := c.AddInterceptor(name, 0, recorder(name, order))
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: []string{"c", "a", "b"},
+		},
+		"skips the rejected": {
+			load: func(c Configurer, order *[]string) error {
+				err := c.AddInterceptor("a", 0, recorder("a", order))
+				if err != nil {
+					return err
+				}
+				err = c.AddInterceptor("b", 1, recorder("b", order, rejected))
+				if err != nil {
+					return err
+				}
+				return c.AddInterceptor("c", 2, recorder("c", order))
+			},
+			want: []string{"a", "c"},
+		},
+		"all rejected": {
+			load: func(c Configurer, order *[]string) error {
+				err := c.AddInterceptor("a", 0, recorder("a", order, rejected))
+				if err != nil {
+					return err
+				}
+				return c.AddInterceptor("b", 0, recorder("b", order, rejected))
+			},
+			want: nil,
+		},
+	}
+
+	for name, tc := range cases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var order []string
+
+			rp, err := New(func(c Configurer) error {
+				err := c.Origin("localhost:8080")
+				if err != nil {
+					return err
+				}
+				err = c.Public("localhost:9090")
+				if err != nil {
+					return err
+				}
+				return tc.load(c, &order)
+			})
+			if err != nil {
+				t.Fatalf("expected error nil, got '%v'", err)
+			}
+
+			err = rp.modify(&http.Response{})
+			if err != nil {
+				t.Fatalf("expected error nil, got '%v'", err)
+			}
+
+			if fmt.Sprint(order) != fmt.Sprint(tc.want) {
+				t.Errorf("expected order %v, got %v", tc.want, order)
+			}
+		})
+	}
+
+	t.Run("compose", func(t *testing.T) {
+		// each interceptor wraps the body, so the result shows the order they were applied
+		wrapper := func(tag string) *interceptorFake {
+			return &interceptorFake{
+				handler: func(r *http.Response) error {
+					content, err := io.ReadAll(r.Body)
+					if err != nil {
+						return err
+					}
+					r.Body = io.NopCloser(strings.NewReader("<" + tag + ">" + string(content) + "</" + tag + ">"))
+					return nil
+				},
+			}
+		}
+
+		rp, err := New(func(c Configurer) error {
+			err := c.Origin("localhost:8080")
+			if err != nil {
+				return err
+			}
+			err = c.Public("localhost:9090")
+			if err != nil {
+				return err
+			}
+			err = c.AddInterceptor("outer", 10, wrapper("b"))
+			if err != nil {
+				return err
+			}
+			return c.AddInterceptor("inner", 5, wrapper("i"))
+		})
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		response := &http.Response{Body: io.NopCloser(strings.NewReader("text"))}
+
+		err = rp.modify(response)
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		content, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		if want := "<b><i>text</i></b>"; string(content) != want {
+			t.Errorf("expected body '%s', got '%s'", want, content)
+		}
+	})
+
+	t.Run("stops on failure", func(t *testing.T) {
+		var order []string
+
+		rp, err := New(func(c Configurer) error {
+			err := c.Origin("localhost:8080")
+			if err != nil {
+				return err
+			}
+			err = c.Public("localhost:9090")
+			if err != nil {
+				return err
+			}
+			err = c.AddInterceptor("failed", 0, &interceptorFake{handler: func(*http.Response) error {
+				return fmt.Errorf("some was wrong")
+			}})
+			if err != nil {
+				return err
+			}
+			return c.AddInterceptor("next", 1, recorder("next", &order))
+		})
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		err = rp.modify(&http.Response{})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+
+		if len(order) != 0 {
+			t.Errorf("expected the chain stopped, got %v", order)
+		}
+	})
+
+	t.Run("nil interceptor", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.AddInterceptor("nil", 0, nil)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+type requestInterceptorFake struct {
+	rules   []interceptor.RequestInterceptorRuler
+	handler interceptor.RequestInterceptorHandler
+}
+
+func (i *requestInterceptorFake) Rules() []interceptor.RequestInterceptorRuler {
+	return i.rules
+}
+
+func (i *requestInterceptorFake) Handler() interceptor.RequestInterceptorHandler {
+	return i.handler
+}
+
+func TestRequestInterceptors(t *testing.T) {
+
+	// origin responds the path and the header X-Test of the requests received.
+	var hits int
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprintf(w, "%s %s", r.URL.Path, r.Header.Get("X-Test"))
+	}))
+	defer origin.Close()
+
+	serve := func(t *testing.T, path string, load func(c Configurer) error) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rp, err := New(func(c Configurer) error {
+			err := c.Origin(origin.URL)
+			if err != nil {
+				return err
+			}
+			err = c.Public("http://localhost:9090")
+			if err != nil {
+				return err
+			}
+			return load(c)
+		})
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		recorder := httptest.NewRecorder()
+		_ = rp.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return recorder
+	}
+
+	t.Run("rewrite", func(t *testing.T) {
+		recorder := serve(t, "/old", func(c Configurer) error {
+			err := c.AddRequestInterceptor("header", 1, &requestInterceptorFake{
+				handler: func(w http.ResponseWriter, r *http.Request) (bool, error) {
+					r.Header.Set("X-Test", r.URL.Path)
+					return false, nil
+				},
+			})
+			if err != nil {
+				return err
+			}
+			return c.AddRequestInterceptor("path", 0, &requestInterceptorFake{
+				rules: []interceptor.RequestInterceptorRuler{func(r *http.Request) bool { return r.URL.Path == "/old" }},
+				handler: func(w http.ResponseWriter, r *http.Request) (bool, error) {
+					r.URL.Path = "/new"
+					return false, nil
+				},
+			})
+		})
+
+		if want := "/new /new"; recorder.Body.String() != want {
+			t.Errorf("expected body '%s', got '%s'", want, recorder.Body.String())
+		}
+	})
+
+	t.Run("skips the rejected", func(t *testing.T) {
+		recorder := serve(t, "/page", func(c Configurer) error {
+			return c.AddRequestInterceptor("path", 0, &requestInterceptorFake{
+				rules: []interceptor.RequestInterceptorRuler{func(r *http.Request) bool { return false }},
+				handler: func(w http.ResponseWriter, r *http.Request) (bool, error) {
+					r.URL.Path = "/new"
+					return false, nil
+				},
+			})
+		})
+
+		if want := "/page "; recorder.Body.String() != want {
+			t.Errorf("expected body '%s', got '%s'", want, recorder.Body.String())
+		}
+	})
+
+	t.Run("short-circuit", func(t *testing.T) {
+		hits = 0
+		called := false
+
+		recorder := serve(t, "/asset.js", func(c Configurer) error {
+			err := c.AddRequestInterceptor("asset", 0, &requestInterceptorFake{
+				handler: func(w http.ResponseWriter, r *http.Request) (bool, error) {
+					w.Header().Set("Content-Type", "text/javascript")
+					_, err := w.Write([]byte("console.log('asset')"))
+					return true, err
+				},
+			})
+			if err != nil {
+				return err
+			}
+			return c.AddRequestInterceptor("next", 1, &requestInterceptorFake{
+				handler: func(w http.ResponseWriter, r *http.Request) (bool, error) {
+					called = true
+					return false, nil
+				},
+			})
+		})
+
+		if hits != 0 {
+			t.Errorf("expected the origin isn't requested, got %d requests", hits)
+		}
+
+		if called {
+			t.Errorf("expected the next interceptor is skipped, got it called")
+		}
+
+		if want := "console.log('asset')"; recorder.Body.String() != want {
+			t.Errorf("expected body '%s', got '%s'", want, recorder.Body.String())
+		}
+	})
+
+	t.Run("marked", func(t *testing.T) {
+		marked := false
+
+		serve(t, "/page", func(c Configurer) error {
+			err := c.AddRequestInterceptor("mark", 0, &requestInterceptorFake{
+				handler: func(w http.ResponseWriter, r *http.Request) (bool, error) {
+					interceptor.MarkRequest(r, "mark")
+					return false, nil
+				},
+			})
+			if err != nil {
+				return err
+			}
+			return c.AddInterceptor("marked", 0, &interceptorFake{
+				handler: func(r *http.Response) error {
+					marked = interceptor.Marked(r, "mark")
+					return nil
+				},
+			})
+		})
+
+		if !marked {
+			t.Errorf("expected the response marked by the request interceptor, got unmarked")
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		hits = 0
+
+		recorder := serve(t, "/page", func(c Configurer) error {
+			return c.AddRequestInterceptor("failed", 0, &requestInterceptorFake{
+				handler: func(w http.ResponseWriter, r *http.Request) (bool, error) {
+					return false, fmt.Errorf("some was wrong")
+				},
+			})
+		})
+
+		if hits != 0 {
+			t.Errorf("expected the origin isn't requested, got %d requests", hits)
+		}
+
+		if recorder.Code != http.StatusBadGateway {
+			t.Errorf("expected status %d, got %d", http.StatusBadGateway, recorder.Code)
+		}
+	})
+
+	t.Run("repeated", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			err := c.AddRequestInterceptor("fake", 0, &requestInterceptorFake{})
+			if err != nil {
+				return err
+			}
+			return c.AddRequestInterceptor("fake", 1, &requestInterceptorFake{})
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.AddRequestInterceptor("nil", 0, nil)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+type streamInterceptorFake struct {
+	interceptorFake
+	transformer interceptor.InterceptorTransformer
+}
+
+func (i *streamInterceptorFake) Transformer() interceptor.InterceptorTransformer {
+	return i.transformer
+}
+
+func TestStream(t *testing.T) {
+
+	// upper returns a stream interceptor that turns the content to upper case, and a handler that must not be called.
+	upper := func(t *testing.T) *streamInterceptorFake {
+		return &streamInterceptorFake{
+			interceptorFake: interceptorFake{
+				handler: func(*http.Response) error {
+					t.Errorf("expected the transformer is used, got the handler called")
+					return nil
+				},
+			},
+			transformer: func(r *http.Response, body io.Reader) io.Reader {
+				content, _ := io.ReadAll(body)
+				return strings.NewReader(strings.ToUpper(string(content)))
+			},
+		}
+	}
+
+	t.Run("identity", func(t *testing.T) {
+		o := origin(t, "", []byte(page))
+		defer o.Close()
+		p := proxy(t, o.URL, upper(t))
+		defer p.Close()
+
+		response, body := get(t, p.URL)
+
+		if response.ContentLength != -1 {
+			t.Errorf("expected the length unknown, got %d", response.ContentLength)
+		}
+
+		if want := strings.ToUpper(page); string(body) != want {
+			t.Errorf("expected body '%s', got '%s'", want, body)
+		}
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		content := compressed(t, "gzip", []byte(page))
+
+		o := origin(t, "gzip", content)
+		defer o.Close()
+		p := proxy(t, o.URL, upper(t))
+		defer p.Close()
+
+		response, body := get(t, p.URL)
+
+		if response.ContentLength != -1 {
+			t.Errorf("expected the length unknown, got %d", response.ContentLength)
+		}
+
+		plain := decompressed(t, "gzip", body)
+
+		if want := strings.ToUpper(page); string(plain) != want {
+			t.Errorf("expected body '%s', got '%s'", want, plain)
+		}
+	})
+
+	t.Run("without body", func(t *testing.T) {
+		rp := &ReverseProxy{}
+		rp.interceptors = []link[interceptor.Interceptor]{{name: "upper", interceptor: upper(t)}}
+
+		response := &http.Response{}
+
+		err := rp.modify(response)
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		if response.Body != nil {
+			t.Errorf("expected body nil, got %v", response.Body)
+		}
+	})
+}
+
+func TestDirectorForwarded(t *testing.T) {
+	rp := &ReverseProxy{origin: &url.URL{Scheme: "http", Host: "localhost:8080"}}
+
+	t.Run("client address", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "http://docs.example.com/pkg", nil)
+
+		rp.director(request)
+
+		if got := request.Header.Get("X-Forwarded-Host"); got != "docs.example.com" {
+			t.Errorf("expected X-Forwarded-Host 'docs.example.com', got '%s'", got)
+		}
+
+		if got := request.Header.Get("X-Forwarded-Proto"); got != "http" {
+			t.Errorf("expected X-Forwarded-Proto 'http', got '%s'", got)
+		}
+
+		if request.Host != "localhost:8080" {
+			t.Errorf("expected host 'localhost:8080', got '%s'", request.Host)
+		}
+	})
+
+	t.Run("kept from other proxy", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "http://localhost:9090/pkg", nil)
+		request.Header.Set("X-Forwarded-Host", "docs.example.com")
+		request.Header.Set("X-Forwarded-Proto", "https")
+
+		rp.director(request)
+
+		if got := request.Header.Get("X-Forwarded-Host"); got != "docs.example.com" {
+			t.Errorf("expected X-Forwarded-Host 'docs.example.com', got '%s'", got)
+		}
+
+		if got := request.Header.Get("X-Forwarded-Proto"); got != "https" {
+			t.Errorf("expected X-Forwarded-Proto 'https', got '%s'", got)
+		}
+	})
+}
+
+func TestErrorHandler(t *testing.T) {
+
+	// the origin is closed, so it can't be reached
+	origin := httptest.NewServer(http.NotFoundHandler())
+	origin.Close()
+
+	serve := func(t *testing.T, load func(c Configurer) error) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rp, err := New(func(c Configurer) error {
+			err := c.Origin(origin.URL)
+			if err != nil {
+				return err
+			}
+			err = c.Public("http://localhost:9090")
+			if err != nil {
+				return err
+			}
+			return load(c)
+		})
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+		rp.proxy.ErrorLog = log.New(io.Discard, "", 0)
+
+		recorder := httptest.NewRecorder()
+		_ = rp.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/page", nil))
+
+		return recorder
+	}
+
+	t.Run("default", func(t *testing.T) {
+		recorder := serve(t, func(c Configurer) error { return nil })
+
+		if recorder.Code != http.StatusBadGateway {
+			t.Errorf("expected status %d, got %d", http.StatusBadGateway, recorder.Code)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		var received error
+
+		recorder := serve(t, func(c Configurer) error {
+			return c.ErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				received = err
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "waiting %s", r.URL.Path)
+			})
+		})
+
+		if received == nil {
+			t.Errorf("expected the error of the origin, got error nil")
+		}
+
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+		}
+
+		if want := "waiting /page"; recorder.Body.String() != want {
+			t.Errorf("expected body '%s', got '%s'", want, recorder.Body.String())
+		}
+	})
+
+	t.Run("interceptor failed", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(page))
+		}))
+		defer origin.Close()
+
+		called := false
+		rp, err := New(func(c Configurer) error {
+			err := c.Origin(origin.URL)
+			if err != nil {
+				return err
+			}
+			err = c.Public("http://localhost:9090")
+			if err != nil {
+				return err
+			}
+			err = c.AddInterceptor("broken", 0, &interceptorFake{handler: func(r *http.Response) error {
+				return fmt.Errorf("some was wrong")
+			}})
+			if err != nil {
+				return err
+			}
+			return c.ErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				called = true
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+		})
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+		rp.proxy.ErrorLog = log.New(io.Discard, "", 0)
+
+		recorder := httptest.NewRecorder()
+		_ = rp.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/page", nil))
+
+		if called {
+			t.Errorf("expected the error handler skipped, got it called")
+		}
+
+		if recorder.Code != http.StatusBadGateway {
+			t.Errorf("expected status %d, got %d", http.StatusBadGateway, recorder.Code)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		called := false
+		rp, err := New(func(c Configurer) error {
+			err := c.Origin(origin.URL)
+			if err != nil {
+				return err
+			}
+			err = c.Public("http://localhost:9090")
+			if err != nil {
+				return err
+			}
+			return c.ErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				called = true
+			})
+		})
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		recorder := httptest.NewRecorder()
+		rp.fail(recorder, httptest.NewRequest(http.MethodGet, "/page", nil), fmt.Errorf("failed to read: %w", context.Canceled))
+
+		if called {
+			t.Errorf("expected the error handler skipped, got it called")
+		}
+
+		if recorder.Body.Len() != 0 || len(recorder.Header()) != 0 {
+			t.Errorf("expected nothing written, got '%s'", recorder.Body.String())
+		}
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.ErrorHandler(nil)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
@@ -3,14 +3,30 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mauroalderete/pkgsite-local-live/index"
+	"github.com/mauroalderete/pkgsite-local-live/interceptor/csp"
+	"github.com/mauroalderete/pkgsite-local-live/interceptor/etag"
 	"github.com/mauroalderete/pkgsite-local-live/interceptor/livereload"
+	"github.com/mauroalderete/pkgsite-local-live/modules"
 	"github.com/mauroalderete/pkgsite-local-live/reverseproxy"
+	"github.com/mauroalderete/pkgsite-local-live/supervisor"
+	"github.com/mauroalderete/pkgsite-local-live/watcher"
+	"github.com/mauroalderete/pkgsite-local-live/websocketconnections"
 	"github.com/mauroalderete/pkgsite-local-live/websocketserver"
 )
 
@@ -18,43 +34,314 @@ import (
 // and serve a websocket connection to handle the livereload system.
 //
 // Stores the address to origin and public endpoints.
-// Initialize a instance of reverseproxy.ReverseProxy and websocketserver.WebsocketServer.
+// Initialize a instance of reverseproxy.ReverseProxy and websocketserver.WebsocketServer,
+// a watcher.Watcher when a directory to watch is configured
+// and a supervisor.Supervisor when a pkgsite binary is configured,
+// that loads the modules found by a modules.Discoverer if a modules root is configured.
+// The modules found can be listed by an index.Index page.
 type server struct {
 	origin            *url.URL
 	public            *url.URL
 	reloadSnippetPath string
+	injectionPoint    livereload.Position
+	csp               livereload.CSPSource
+	client            http.Handler
+	dev               bool
+	watchRoot         string
+	watchExtensions   []string
+	watchPolling      bool
+	watchInterval     time.Duration
+	pkgsiteBinary     string
+	pkgsiteArgs       []string
+	pkgsitePort       int
+	modulesRoot       string
+	modulesFilter     string
+	indexPath         string
+	waitOrigin        time.Duration
+	pingInterval      time.Duration
+	pongWait          time.Duration
+	reconnectInterval time.Duration
+	buildID           string
+	websocketOrigins  []string
+	http              *http.Server
 	proxy             *reverseproxy.ReverseProxy
 	websocket         *websocketserver.WebsocketServer
+	watcher           *watcher.Watcher
+	pkgsite           *supervisor.Supervisor
+	modules           *modules.Discoverer
+	found             []modules.Module
+	foundFresh        bool
+	foundMutex        sync.Mutex
+	index             *index.Index
 }
 
 // Run uploads a new serverMux and launch it.
 func (s *server) Run() error {
+	address := s.http.Addr
+	if address == "" {
+		address = ":http"
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen %s: %v", address, err)
+	}
+
+	return s.serve(listener)
+}
+
+// serve launches the serverMux over the listener passed, and the pkgsite process and the watcher if they are configured.
+//
+// This method is blocked until [server.Shutdown] is called or the server fails.
+func (s *server) serve(listener net.Listener) error {
 
 	serverMux := http.NewServeMux()
 
+	// handler to serve the script of the reload client, that is loaded by the snippet
+	serverMux.Handle(livereload.ClientPath, s.client)
+
 	// handler to accept a new websocket connection
 	serverMux.HandleFunc("/ws", func(response http.ResponseWriter, request *http.Request) {
 		s.websocket.WebsocketHandler(response, request)
 	})
 
+	// handler to accept a new event stream connection, when the websocket can't be used
+	serverMux.HandleFunc("/ws/events", func(response http.ResponseWriter, request *http.Request) {
+		s.websocket.EventsHandler(response, request)
+	})
+
 	// handler to send broadcast reload signal
 	serverMux.HandleFunc("/ws/reload", func(response http.ResponseWriter, request *http.Request) {
 		s.websocket.ReloadHandler(response, request)
 	})
 
-	// handler to redirect any connection
+	// handler to redirect any connection, or to serve the modules index
 	serverMux.HandleFunc("/", func(response http.ResponseWriter, request *http.Request) {
-		s.proxy.ServeHTTP(response, request)
+		if s.index != nil && request.URL.Path == s.indexPath {
+			s.index.ServeHTTP(response, request)
+			return
+		}
+		err := s.proxy.ServeHTTP(response, request)
+		if err != nil {
+			log.Printf("failed to serve %s: %v", request.URL, err)
+		}
 	})
 
-	err := http.ListenAndServe(s.public.Host, serverMux)
-	if err != nil {
+	if s.pkgsite != nil {
+		// the workspace could not have modules yet, so the server continues
+		// waiting for the watcher to detect them.
+		err := s.pkgsite.Start()
+		if err != nil {
+			log.Printf("failed to start the pkgsite process: %v", err)
+		}
+	}
+
+	if s.watcher != nil {
+		go s.watch()
+	}
+
+	s.http.Handler = serverMux
+
+	err := s.http.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to execute the main server: %v", err)
 	}
 
 	return nil
 }
 
+// Shutdown stops the server gracefully.
+//
+// Stops the watcher, sends a close frame to the websocket connections, waits the pending requests
+// until the context is done and stops the pkgsite process if it is supervised.
+// Once it is called, [server.Run] returns nil.
+func (s *server) Shutdown(ctx context.Context) error {
+	var errs []string
+
+	if s.watcher != nil {
+		s.watcher.Stop()
+	}
+
+	s.websocket.Shutdown()
+
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("failed to shutdown the main server: %v", err))
+	}
+
+	if s.pkgsite != nil {
+		err := s.pkgsite.Stop()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to stop pkgsite: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// watch runs the watcher and sends the reload signal each time that it detects changes.
+//
+// If the pkgsite process is supervised, the clients are notified while it is restarted
+// and receive an error message if it fails. When only stylesheets changed, the clients refresh them without reloading.
+// If the modules are discovered, only the clients viewing the modules changed are notified.
+func (s *server) watch() {
+	log.Printf("Watching changes in %s\n", s.watcher.Root())
+
+	err := s.watcher.Run(func(events []watcher.Event) {
+		for _, e := range events {
+			log.Printf("%s %s\n", e.Op, e.Path)
+		}
+
+		var found []modules.Module
+		if s.modules != nil {
+			// the modules are discovered once per batch, the restart of pkgsite reuses them
+			var err error
+			found, err = s.refresh()
+			if err != nil {
+				log.Printf("failed to discover the modules changed: %v", err)
+			}
+		}
+
+		prefixes := affected(events, found)
+
+		if s.pkgsite != nil {
+			s.notify(websocketconnections.Status, "restarting pkgsite", prefixes)
+
+			err := s.pkgsite.Restart()
+			if err != nil {
+				log.Printf("failed to restart pkgsite: %v", err)
+				s.notify(websocketconnections.Error, fmt.Sprintf("failed to restart pkgsite: %v", err), prefixes)
+				return
+			}
+		}
+
+		t := websocketconnections.Reload
+		if onlyStylesheets(events) {
+			t = websocketconnections.CSS
+		}
+
+		s.notify(t, "", prefixes)
+	})
+	if err != nil {
+		log.Printf("watcher stopped: %v", err)
+	}
+}
+
+// notify sends a message to the websocket clients viewing the pages under the prefixes, logging the error if it fails.
+func (s *server) notify(t websocketconnections.MessageType, text string, prefixes []string) {
+	err := s.websocket.Notify(t, text, prefixes...)
+	if err != nil {
+		log.Printf("failed to send %s message: %v", t, err)
+	}
+}
+
+// affected returns the path prefixes of the pages of the modules found that contain the files changed.
+//
+// Returns nil, that means all pages, if the modules aren't found
+// or some file changed doesn't belong to any module, as the filter file.
+func affected(events []watcher.Event, found []modules.Module) []string {
+	if len(found) == 0 {
+		return nil
+	}
+
+	prefixes := []string{}
+	seen := map[string]bool{}
+	for _, e := range events {
+		owner, ok := modules.Owner(found, e.Path)
+		if !ok {
+			return nil
+		}
+
+		if !seen[owner.Path] {
+			seen[owner.Path] = true
+			prefixes = append(prefixes, "/"+owner.Path)
+		}
+	}
+
+	return prefixes
+}
+
+// onlyStylesheets returns true if all files changed are css files.
+func onlyStylesheets(events []watcher.Event) bool {
+	if len(events) == 0 {
+		return false
+	}
+
+	for _, e := range events {
+		if !strings.EqualFold(filepath.Ext(e.Path), ".css") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// refresh discovers the modules and stores them, so the next restart of pkgsite takes them instead of walking the tree again.
+func (s *server) refresh() ([]modules.Module, error) {
+	found, err := s.modules.Discover()
+	if err != nil {
+		s.foundMutex.Lock()
+		s.foundFresh = false
+		s.foundMutex.Unlock()
+		return nil, err
+	}
+
+	s.store(found, true)
+	return found, nil
+}
+
+// discovered returns the modules stored by the last refresh if no restart took them yet, otherwise it discovers them again.
+func (s *server) discovered() ([]modules.Module, error) {
+	s.foundMutex.Lock()
+	if s.foundFresh {
+		s.foundFresh = false
+		found := s.found
+		s.foundMutex.Unlock()
+		return found, nil
+	}
+	s.foundMutex.Unlock()
+
+	found, err := s.modules.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	s.store(found, false)
+	return found, nil
+}
+
+// store keeps the modules found, and computes the index again with them if it is served.
+func (s *server) store(found []modules.Module, fresh bool) {
+	s.foundMutex.Lock()
+	s.found = found
+	s.foundFresh = fresh
+	s.foundMutex.Unlock()
+
+	if s.index != nil {
+		s.index.Update(found)
+	}
+}
+
+// discover returns the pkgsite argument with the comma separated list of the modules directories found.
+func (s *server) discover() ([]string, error) {
+	found, err := s.discovered()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover modules: %v", err)
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("there are not modules in %s", s.modules.Root())
+	}
+
+	log.Printf("%d modules found in %s\n", len(found), s.modules.Root())
+
+	return []string{strings.Join(modules.Dirs(found), ",")}, nil
+}
+
 // Configurator defines the properties configurables to instance a new Server
 type Configurator interface {
 	// Origin allows set the address to the origin endpoint of the reverse proxy.
@@ -66,7 +353,69 @@ type Configurator interface {
 	// ReloadSnippet allows set the path to the file that contains the snippet
 	// that is needed to inject in each request with html content
 	// to the browser can be reloaded when it needed.
+	// If it isn't configured, the default client of livereload is injected.
 	ReloadSnippet(path string) error
+
+	// InjectionPoint allows set where the snippet is injected in the html pages,
+	// "body" to the end of the body, that is the default, or "head" to the end of the head.
+	InjectionPoint(position string) error
+
+	// CSP allows set how the script of the reload client is allowed by the Content-Security-Policy of the pages,
+	// "none" to keep the policies as they are, that is the default, "nonce" or "hash".
+	CSP(source string) error
+
+	// Dev allows enable the development mode, where the pages modified are sent with `Cache-Control: no-store`,
+	// so the browsers never cache them.
+	Dev(enable bool) error
+
+	// Watch allows set the directory that must be watched to send the reload signal when it changes.
+	Watch(path string) error
+
+	// WatchExtensions allows set the extensions of the files that must be watched.
+	WatchExtensions(extensions []string) error
+
+	// WatchPolling allows force the watcher to walk the directory periodically instead of use the native notifications.
+	WatchPolling(enable bool) error
+
+	// WatchInterval allows set the time that the changes are grouped before sending the reload signal.
+	WatchInterval(interval time.Duration) error
+
+	// Pkgsite allows set the path to the pkgsite binary that the server must supervise.
+	Pkgsite(binary string) error
+
+	// PkgsiteArgs allows set the extra arguments passed to the pkgsite process, as the modules to load.
+	PkgsiteArgs(args []string) error
+
+	// PkgsitePort allows set the port where the pkgsite process must listen.
+	PkgsitePort(port int) error
+
+	// Modules allows set the directory where the modules loaded by pkgsite are discovered in each restart.
+	Modules(root string) error
+
+	// ModulesFilter allows set the path to the yaml file that selects the modules discovered to load.
+	// The changes of the file restart pkgsite when a directory to watch is configured.
+	ModulesFilter(path string) error
+
+	// Index allows set the path where a page with the list of the modules discovered is served.
+	// It requires a modules directory configured.
+	Index(path string) error
+
+	// WaitOrigin allows set the maximum time to wait for the origin to respond successfully
+	// before sending the reload signal. If it is zero, the reload signal is sent without waiting.
+	WaitOrigin(timeout time.Duration) error
+
+	// PingInterval allows set the time between the pings sent to each websocket client.
+	PingInterval(interval time.Duration) error
+
+	// PongWait allows set the maximum time to wait for the pong of a websocket client before closing it.
+	PongWait(wait time.Duration) error
+
+	// ReconnectInterval allows set the time that the reload snippet waits before connecting again when the connection is lost.
+	ReconnectInterval(interval time.Duration) error
+
+	// WebsocketOrigins allows set the patterns of the origins that can open a websocket connection,
+	// as a list of addresses with wildcard hosts, "public" for the same address of the server, or "*" for all.
+	WebsocketOrigins(origins []string) error
 }
 
 // Implement server.Configurator interface. Stores a pool of configurations callback
@@ -120,10 +469,265 @@ func (c *configure) ReloadSnippet(path string) error {
 	return nil
 }
 
+// InjectionPoint implement server.Configurator.InjectionPoint method
+func (c *configure) InjectionPoint(position string) error {
+
+	p, err := livereload.ParsePosition(position)
+	if err != nil {
+		return err
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.injectionPoint = p
+		return nil
+	})
+
+	return nil
+}
+
+// CSP implement server.Configurator.CSP method
+func (c *configure) CSP(source string) error {
+
+	csp, err := livereload.ParseCSPSource(source)
+	if err != nil {
+		return err
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.csp = csp
+		return nil
+	})
+
+	return nil
+}
+
+// Watch implement server.Configurator.Watch method
+func (c *configure) Watch(path string) error {
+
+	if path == "" {
+		return fmt.Errorf("watch path cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.watchRoot = path
+		return nil
+	})
+
+	return nil
+}
+
+// WatchExtensions implement server.Configurator.WatchExtensions method
+func (c *configure) WatchExtensions(extensions []string) error {
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.watchExtensions = extensions
+		return nil
+	})
+
+	return nil
+}
+
+// Dev implement server.Configurator.Dev method
+func (c *configure) Dev(enable bool) error {
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.dev = enable
+		return nil
+	})
+
+	return nil
+}
+
+// WatchPolling implement server.Configurator.WatchPolling method
+func (c *configure) WatchPolling(enable bool) error {
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.watchPolling = enable
+		return nil
+	})
+
+	return nil
+}
+
+// WatchInterval implement server.Configurator.WatchInterval method
+func (c *configure) WatchInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("watch interval must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.watchInterval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// Pkgsite implement server.Configurator.Pkgsite method
+func (c *configure) Pkgsite(binary string) error {
+
+	if binary == "" {
+		return fmt.Errorf("pkgsite binary cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.pkgsiteBinary = binary
+		return nil
+	})
+
+	return nil
+}
+
+// PkgsiteArgs implement server.Configurator.PkgsiteArgs method
+func (c *configure) PkgsiteArgs(args []string) error {
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.pkgsiteArgs = args
+		return nil
+	})
+
+	return nil
+}
+
+// PkgsitePort implement server.Configurator.PkgsitePort method
+func (c *configure) PkgsitePort(port int) error {
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.pkgsitePort = port
+		return nil
+	})
+
+	return nil
+}
+
+// Modules implement server.Configurator.Modules method
+func (c *configure) Modules(root string) error {
+
+	if root == "" {
+		return fmt.Errorf("modules root cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.modulesRoot = root
+		return nil
+	})
+
+	return nil
+}
+
+// ModulesFilter implement server.Configurator.ModulesFilter method
+func (c *configure) ModulesFilter(path string) error {
+
+	if path == "" {
+		return fmt.Errorf("modules filter path cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.modulesFilter = path
+		return nil
+	})
+
+	return nil
+}
+
+// Index implement server.Configurator.Index method
+func (c *configure) Index(path string) error {
+
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("index path '%s' must start with /", path)
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.indexPath = path
+		return nil
+	})
+
+	return nil
+}
+
+// WaitOrigin implement server.Configurator.WaitOrigin method
+func (c *configure) WaitOrigin(timeout time.Duration) error {
+
+	if timeout < 0 {
+		return fmt.Errorf("wait origin timeout cannot be negative")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.waitOrigin = timeout
+		return nil
+	})
+
+	return nil
+}
+
+// PingInterval implement server.Configurator.PingInterval method
+func (c *configure) PingInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("ping interval must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.pingInterval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// ReconnectInterval implement server.Configurator.ReconnectInterval method
+func (c *configure) ReconnectInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("reconnect interval must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.reconnectInterval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// PongWait implement server.Configurator.PongWait method
+func (c *configure) PongWait(wait time.Duration) error {
+
+	if wait <= 0 {
+		return fmt.Errorf("pong wait must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.pongWait = wait
+		return nil
+	})
+
+	return nil
+}
+
+// WebsocketOrigins implement server.Configurator.WebsocketOrigins method
+func (c *configure) WebsocketOrigins(origins []string) error {
+
+	_, err := websocketconnections.NewOriginPolicy(origins...)
+	if err != nil {
+		return fmt.Errorf("invalid websocket origins: %v", err)
+	}
+
+	c.pool = append(c.pool, func(s *server) error {
+		s.websocketOrigins = origins
+		return nil
+	})
+
+	return nil
+}
+
 // New instances of a new server object using the properties configured through the callbacks options list.
 //
 // If the options are accepted, loads a new instances of reverseproxy.ReverseProxy,
 // a livereload.Livereload interceptor and a websocketserver.WebsockerServer manager.
+// If a directory to watch is configured, loads a watcher.Watcher too,
+// and if a pkgsite binary is configured, loads a supervisor.Supervisor.
 func New(options ...func(Configurator) error) (*server, error) {
 
 	cnf := &configure{}
@@ -135,7 +739,10 @@ func New(options ...func(Configurator) error) (*server, error) {
 		}
 	}
 
-	srv := &server{}
+	// identifies this instance of the server, so the clients can know when it changes
+	srv := &server{
+		buildID: strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
 
 	for _, config := range cnf.pool {
 		err := config(srv)
@@ -152,6 +759,9 @@ func New(options ...func(Configurator) error) (*server, error) {
 		return nil, fmt.Errorf("public address is required")
 	}
 
+	// the endpoints are paths, so the snippet resolves them with the address used by the browser
+	prefix := strings.TrimSuffix(srv.public.Path, "/")
+
 	// load a reverse proxy instance
 	rp, err := reverseproxy.New(func(c reverseproxy.Configurer) error {
 		err := c.Origin(srv.origin.String())
@@ -164,7 +774,7 @@ func New(options ...func(Configurator) error) (*server, error) {
 			return fmt.Errorf("failed to set the public address of the reverse proxy: %v", err)
 		}
 
-		livereload, err := livereload.New(
+		reloader, err := livereload.New(
 			// injects dependencies
 			func(c livereload.Configurer) error {
 				err := c.OpenFile(os.Open)
@@ -181,14 +791,53 @@ func New(options ...func(Configurator) error) (*server, error) {
 			},
 			// configures the instance
 			func(c livereload.Configurer) error {
-				err := c.UpgradeEndpoint(srv.public.String() + "/ws")
+				err := c.UpgradeEndpoint(prefix + "/ws")
 				if err != nil {
 					return fmt.Errorf("failed to set the upgrade endpoint to livereload interceptor: %v", err)
 				}
 
-				err = c.WebserviceInjectable(srv.reloadSnippetPath)
+				err = c.EventsEndpoint(prefix + "/ws/events")
+				if err != nil {
+					return fmt.Errorf("failed to set the events endpoint to livereload interceptor: %v", err)
+				}
+
+				err = c.ProtocolVersion(websocketconnections.ProtocolVersion)
+				if err != nil {
+					return fmt.Errorf("failed to set the protocol version to livereload interceptor: %v", err)
+				}
+
+				err = c.BuildID(srv.buildID)
+				if err != nil {
+					return fmt.Errorf("failed to set the build id to livereload interceptor: %v", err)
+				}
+
+				if srv.reconnectInterval > 0 {
+					err = c.ReconnectInterval(srv.reconnectInterval)
+					if err != nil {
+						return fmt.Errorf("failed to set the reconnect interval to livereload interceptor: %v", err)
+					}
+				}
+
+				if srv.reloadSnippetPath != "" {
+					err = c.WebserviceInjectable(srv.reloadSnippetPath)
+					if err != nil {
+						return fmt.Errorf("failed to set the reload snippet path to livereload interceptor: %v", err)
+					}
+				}
+
+				err = c.InjectionPoint(srv.injectionPoint)
+				if err != nil {
+					return fmt.Errorf("failed to set the injection point to livereload interceptor: %v", err)
+				}
+
+				err = c.ClientEndpoint(prefix + livereload.ClientPath)
+				if err != nil {
+					return fmt.Errorf("failed to set the client endpoint to livereload interceptor: %v", err)
+				}
+
+				err = c.CSP(srv.csp)
 				if err != nil {
-					return fmt.Errorf("failed to set the reload snippet path to livereload interceptor: %v", err)
+					return fmt.Errorf("failed to set the csp source to livereload interceptor: %v", err)
 				}
 				return nil
 			})
@@ -196,7 +845,90 @@ func New(options ...func(Configurator) error) (*server, error) {
 			return fmt.Errorf("failed to set livereload interceptor of the reverse proxy: %v", err)
 		}
 
-		c.AddInterceptor("livereload", livereload)
+		client, ok := reloader.(*livereload.Livereload)
+		if !ok {
+			return fmt.Errorf("livereload interceptor doesn't serve the client script")
+		}
+		srv.client = client
+
+		// while pkgsite restarts, the browsers get a waiting page with the client, that reloads once pkgsite is back
+		err = c.ErrorHandler(client.Waiting)
+		if err != nil {
+			return fmt.Errorf("failed to set the error handler of the reverse proxy: %v", err)
+		}
+
+		// livereload runs first, so the interceptors loaded later can work on the page with the snippet
+		err = c.AddInterceptor("livereload", 0, reloader)
+		if err != nil {
+			return fmt.Errorf("failed to add livereload interceptor to the reverse proxy: %v", err)
+		}
+
+		// allows the client in the Content-Security-Policy of the pages where livereload injected the snippet
+		policy, err := csp.New(func(c csp.Configurer) error {
+			err := c.After(livereload.Mark)
+			if err != nil {
+				return fmt.Errorf("failed to set the mark to csp interceptor: %v", err)
+			}
+
+			err = c.Script(prefix + livereload.ClientPath)
+			if err != nil {
+				return fmt.Errorf("failed to set the script path to csp interceptor: %v", err)
+			}
+
+			err = c.Websocket(prefix + "/ws")
+			if err != nil {
+				return fmt.Errorf("failed to set the websocket path to csp interceptor: %v", err)
+			}
+
+			err = c.Events(prefix + "/ws/events")
+			if err != nil {
+				return fmt.Errorf("failed to set the events path to csp interceptor: %v", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set csp interceptor of the reverse proxy: %v", err)
+		}
+
+		err = c.AddInterceptor("csp", 10, policy)
+		if err != nil {
+			return fmt.Errorf("failed to add csp interceptor to the reverse proxy: %v", err)
+		}
+
+		// rewrites the validators of the pages where livereload injected the snippet, so the browsers never reuse
+		// a page cached without it or by other build, and translates them back in the conditional requests
+		validators, err := etag.New(func(c etag.Configurer) error {
+			err := c.After(livereload.Mark)
+			if err != nil {
+				return fmt.Errorf("failed to set the mark to etag interceptor: %v", err)
+			}
+
+			err = c.BuildID(srv.buildID)
+			if err != nil {
+				return fmt.Errorf("failed to set the build id to etag interceptor: %v", err)
+			}
+
+			err = c.NoStore(srv.dev)
+			if err != nil {
+				return fmt.Errorf("failed to set the no store mode to etag interceptor: %v", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set etag interceptor of the reverse proxy: %v", err)
+		}
+
+		err = c.AddRequestInterceptor("etag", 0, validators.Request())
+		if err != nil {
+			return fmt.Errorf("failed to add etag request interceptor to the reverse proxy: %v", err)
+		}
+
+		err = c.AddInterceptor("etag", 20, validators.Response())
+		if err != nil {
+			return fmt.Errorf("failed to add etag interceptor to the reverse proxy: %v", err)
+		}
 
 		return nil
 	})
@@ -206,12 +938,54 @@ func New(options ...func(Configurator) error) (*server, error) {
 
 	srv.proxy = rp
 
+	srv.http = &http.Server{Addr: srv.public.Host}
+
 	// prepare a websocket server
 	ws, err := websocketserver.New(func(c websocketserver.Configurator) error {
 		err = c.Endpoint(srv.public.String())
 		if err != nil {
 			return fmt.Errorf("failed to set endpoint to websocket server: %v", err)
 		}
+
+		if srv.pingInterval > 0 {
+			err = c.PingInterval(srv.pingInterval)
+			if err != nil {
+				return fmt.Errorf("failed to set ping interval to websocket server: %v", err)
+			}
+		}
+
+		if srv.pongWait > 0 {
+			err = c.PongWait(srv.pongWait)
+			if err != nil {
+				return fmt.Errorf("failed to set pong wait to websocket server: %v", err)
+			}
+		}
+
+		err = c.Public(srv.public.String())
+		if err != nil {
+			return fmt.Errorf("failed to set public address to websocket server: %v", err)
+		}
+
+		if len(srv.websocketOrigins) > 0 {
+			err = c.Origins(srv.websocketOrigins...)
+			if err != nil {
+				return fmt.Errorf("failed to set origins to websocket server: %v", err)
+			}
+		}
+
+		if srv.waitOrigin == 0 {
+			return nil
+		}
+
+		err = c.Healthcheck(srv.origin.String())
+		if err != nil {
+			return fmt.Errorf("failed to set healthcheck to websocket server: %v", err)
+		}
+
+		err = c.HealthcheckTimeout(srv.waitOrigin)
+		if err != nil {
+			return fmt.Errorf("failed to set healthcheck timeout to websocket server: %v", err)
+		}
 		return nil
 	})
 	if err != nil {
@@ -220,5 +994,129 @@ func New(options ...func(Configurator) error) (*server, error) {
 
 	srv.websocket = ws
 
+	if srv.modulesRoot != "" {
+		// prepare the discoverer of the modules to load
+		md, err := modules.New(func(c modules.Configurer) error {
+			err := c.Root(srv.modulesRoot)
+			if err != nil {
+				return fmt.Errorf("failed to set the root to modules discoverer: %v", err)
+			}
+
+			if srv.modulesFilter == "" {
+				return nil
+			}
+
+			err = c.FilterFile(srv.modulesFilter)
+			if err != nil {
+				return fmt.Errorf("failed to set the filter to modules discoverer: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to up the modules discoverer: %v", err)
+		}
+
+		srv.modules = md
+	}
+
+	if srv.indexPath != "" {
+		if srv.modules == nil {
+			return nil, fmt.Errorf("index requires a modules directory")
+		}
+
+		// prepare the page with the list of modules
+		ix, err := index.New(func(c index.Configurer) error {
+			err := c.Source(srv.modules.Discover)
+			if err != nil {
+				return fmt.Errorf("failed to set the source to index: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to up the index: %v", err)
+		}
+
+		srv.index = ix
+	}
+
+	if srv.pkgsiteBinary != "" {
+		// prepare the supervisor of the pkgsite process
+		sp, err := supervisor.New(func(c supervisor.Configurer) error {
+			err := c.Binary(srv.pkgsiteBinary)
+			if err != nil {
+				return fmt.Errorf("failed to set the binary to supervisor: %v", err)
+			}
+
+			err = c.Args(srv.pkgsiteArgs...)
+			if err != nil {
+				return fmt.Errorf("failed to set the arguments to supervisor: %v", err)
+			}
+
+			err = c.Port(srv.pkgsitePort)
+			if err != nil {
+				return fmt.Errorf("failed to set the port to supervisor: %v", err)
+			}
+
+			if srv.modules == nil {
+				return nil
+			}
+
+			err = c.ArgsFunc(srv.discover)
+			if err != nil {
+				return fmt.Errorf("failed to set the modules discovery to supervisor: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to up the pkgsite supervisor: %v", err)
+		}
+
+		srv.pkgsite = sp
+	}
+
+	if srv.watchRoot == "" {
+		return srv, nil
+	}
+
+	// prepare a watcher of the workspace
+	wt, err := watcher.New(func(c watcher.Configurer) error {
+		err := c.Root(srv.watchRoot)
+		if err != nil {
+			return fmt.Errorf("failed to set the root to watcher: %v", err)
+		}
+
+		err = c.Extensions(srv.watchExtensions...)
+		if err != nil {
+			return fmt.Errorf("failed to set the extensions to watcher: %v", err)
+		}
+
+		err = c.Polling(srv.watchPolling)
+		if err != nil {
+			return fmt.Errorf("failed to set the polling mode to watcher: %v", err)
+		}
+
+		if srv.watchInterval > 0 {
+			err = c.Interval(srv.watchInterval)
+			if err != nil {
+				return fmt.Errorf("failed to set the interval to watcher: %v", err)
+			}
+		}
+
+		if srv.modulesFilter == "" {
+			return nil
+		}
+
+		err = c.Files(srv.modulesFilter)
+		if err != nil {
+			return fmt.Errorf("failed to set the modules filter to watcher: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to up the watcher: %v", err)
+	}
+
+	srv.watcher = wt
+
 	return srv, nil
 }
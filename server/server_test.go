@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mauroalderete/pkgsite-local-live/modules"
+	"github.com/mauroalderete/pkgsite-local-live/supervisor"
+	"github.com/mauroalderete/pkgsite-local-live/watcher"
+)
+
+// TestHelperProcess is not a real test, it is the fake pkgsite executed by the server in the tests.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("SERVER_HELPER") == "" {
+		return
+	}
+
+	// terminates by the interrupt signal sent by the supervisor
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+// changed returns an event of write for each path passed.
+func changed(paths ...string) []watcher.Event {
+	events := []watcher.Event{}
+	for _, path := range paths {
+		events = append(events, watcher.Event{Path: path, Op: watcher.Write})
+	}
+	return events
+}
+
+func TestAffected(t *testing.T) {
+	found := []modules.Module{
+		{Path: "example.com/a", Dir: "/go/src/a"},
+		{Path: "example.com/a/nested", Dir: "/go/src/a/nested"},
+		{Path: "example.com/b", Dir: "/go/src/b"},
+	}
+
+	cases := map[string]struct {
+		events   []watcher.Event
+		found    []modules.Module
+		expected []string
+	}{
+		"one module":         {changed("/go/src/a/a.go"), found, []string{"/example.com/a"}},
+		"nested module":      {changed("/go/src/a/nested/pkg/b.go"), found, []string{"/example.com/a/nested"}},
+		"same module twice":  {changed("/go/src/a/a.go", "/go/src/a/doc.md"), found, []string{"/example.com/a"}},
+		"many modules":       {changed("/go/src/b/b.go", "/go/src/a/a.go"), found, []string{"/example.com/b", "/example.com/a"}},
+		"parent and nested":  {changed("/go/src/a/a.go", "/go/src/a/nested/n.go"), found, []string{"/example.com/a", "/example.com/a/nested"}},
+		"outside any module": {changed("/app/modules.yml"), found, nil},
+		"some outside":       {changed("/go/src/a/a.go", "/go/src/c/c.go"), found, nil},
+		"without modules":    {changed("/go/src/a/a.go"), nil, nil},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			got := affected(tc.events, tc.found)
+
+			if (got == nil) != (tc.expected == nil) || fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestOnlyStylesheets(t *testing.T) {
+	cases := map[string]struct {
+		events   []watcher.Event
+		expected bool
+	}{
+		"css":       {changed("/go/src/a/static/style.css"), true},
+		"many css":  {changed("/go/src/a/a.css", "/go/src/b/b.css"), true},
+		"upper css": {changed("/go/src/a/STYLE.CSS"), true},
+		"go":        {changed("/go/src/a/a.go"), false},
+		"mixed":     {changed("/go/src/a/a.css", "/go/src/a/a.go"), false},
+		"empty":     {nil, false},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			if got := onlyStylesheets(tc.events); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Setenv("SERVER_HELPER", "pkgsite")
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body></body></html>"))
+	}))
+	defer origin.Close()
+
+	snippet := filepath.Join(t.TempDir(), "snippet.html")
+	err := os.WriteFile(snippet, []byte("<script></script>"), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write the snippet: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	srv, err := New(func(c Configurator) error {
+		err := c.Origin(origin.URL)
+		if err != nil {
+			return err
+		}
+		err = c.Public("http://" + listener.Addr().String())
+		if err != nil {
+			return err
+		}
+		err = c.ReloadSnippet(snippet)
+		if err != nil {
+			return err
+		}
+		err = c.Pkgsite(os.Args[0])
+		if err != nil {
+			return err
+		}
+		return c.PkgsiteArgs([]string{"-test.run=TestHelperProcess"})
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the server: %v", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.serve(listener)
+	}()
+
+	header := http.Header{}
+	header.Set("Origin", "http://localhost")
+
+	var client *websocket.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for client == nil || srv.websocket.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the websocket client connected, got timeout")
+		}
+
+		if client == nil {
+			client, _, _ = websocket.DefaultDialer.Dial("ws://"+listener.Addr().String()+"/ws", header)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer client.Close()
+
+	if srv.pkgsite.State() != supervisor.Running {
+		t.Fatalf("expected pkgsite %s, got %s", supervisor.Running, srv.pkgsite.State())
+	}
+	done := srv.pkgsite.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		t.Errorf("expected error nil, got '%v'", err)
+	}
+
+	if ctx.Err() != nil {
+		t.Errorf("expected the shutdown returned within the context, got '%v'", ctx.Err())
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going away close frame, got '%v'", err)
+	}
+
+	select {
+	case <-done:
+	default:
+		t.Errorf("expected pkgsite reaped, got it alive")
+	}
+
+	if srv.pkgsite.State() != supervisor.Stopped {
+		t.Errorf("expected pkgsite %s, got %s", supervisor.Stopped, srv.pkgsite.State())
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the server stopped, got it serving")
+	}
+}
@@ -0,0 +1,241 @@
+// Package sseconnections allows to handle the Server-Sent Events connections to reload the clients when is needed.
+//
+// It is the fallback of the websocket connections for the networks that don't allow to upgrade the requests,
+// as some proxies. The messages sent are the same of the websocket protocol, see [websocketconnections.Message].
+package sseconnections
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/mauroalderete/pkgsite-local-live/websocketconnections"
+)
+
+// queueSize is the number of messages that can wait to be written to a client.
+// If a client is so slow that the queue is full, it is disconnected, so it never blocks the messages to other clients.
+const queueSize = 16
+
+// Connection models a connection to the client through an event stream.
+//
+// It keeps the response of the request opened to write the messages as events. Manage the connection lifecicle.
+type Connection struct {
+	uuid     uuid.UUID
+	response http.ResponseWriter
+	request  *http.Request
+	flusher  http.Flusher
+	messages chan websocketconnections.Message
+
+	// page is the path of the page that opened the connection, reported by the client with the `page` query parameter.
+	page string
+
+	// started is true since the connection begins to write the events until it is stopped.
+	started atomic.Bool
+
+	// done is closed when the connection is stopped.
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// UUID returns the uuid assiged to the connection.
+func (c *Connection) UUID() string {
+	return c.uuid.String()
+}
+
+// Page returns the path of the page that opened the connection, or empty if the client didn't report it.
+func (c *Connection) Page() string {
+	return c.page
+}
+
+// Viewing returns true if the page of the connection is under some of the path prefixes passed.
+//
+// See [websocketconnections.MatchPage] to know how the prefixes are matched.
+func (c *Connection) Viewing(prefixes ...string) bool {
+	return websocketconnections.MatchPage(c.page, prefixes...)
+}
+
+// Open writes the headers of the event stream, so the client knows that the connection is establishment.
+func (c *Connection) Open() error {
+	header := c.response.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+
+	c.response.WriteHeader(http.StatusOK)
+
+	_, err := fmt.Fprint(c.response, ": connected\n\n")
+	if err != nil {
+		return fmt.Errorf("(%s) failed to open the event stream: %v", c.UUID(), err)
+	}
+	c.flusher.Flush()
+
+	c.page = c.request.URL.Query().Get("page")
+
+	return nil
+}
+
+// Start writes the messages received as events until the connection is stopped,
+// by the client closing the request or calling [Connection.Stop].
+//
+// This method is blocked, and it must be called from the handler of the request, because the response can't be written after.
+func (c *Connection) Start() error {
+
+	c.started.Store(true)
+
+	for {
+		select {
+		case message := <-c.messages:
+			{
+				data, err := message.Encode()
+				if err != nil {
+					log.Printf("(%s) failed to encode %s message: %s", c.UUID(), message.Type, err)
+					break
+				}
+
+				_, err = fmt.Fprintf(c.response, "data: %s\n\n", data)
+				if err != nil {
+					log.Printf("(%s) failed to send %s message: %s", c.UUID(), message.Type, err)
+					c.Stop()
+					break
+				}
+				c.flusher.Flush()
+			}
+		case <-c.request.Context().Done():
+			{
+				c.Stop()
+			}
+		case <-c.done:
+			{
+				log.Printf("(%s) stoping event stream", c.UUID())
+				return nil
+			}
+		}
+	}
+}
+
+// Send enqueues a message to be written to the client, even if the connection is not started yet.
+//
+// This method is never blocked. Returns an error if the connection is stopped,
+// or if the queue of the client is full, in which case the connection is stopped because the client is too slow.
+func (c *Connection) Send(message websocketconnections.Message) error {
+	select {
+	case <-c.done:
+		return fmt.Errorf("(%s) failed to send %s message, so the connection is stopped", c.UUID(), message.Type)
+	default:
+	}
+
+	select {
+	case c.messages <- message:
+		return nil
+	default:
+		c.Stop()
+		return fmt.Errorf("(%s) failed to send %s message, so the client is too slow and it is disconnected", c.UUID(), message.Type)
+	}
+}
+
+// Reload enables the sending of the reload message to the client.
+func (c *Connection) Reload() error {
+	message, err := websocketconnections.NewMessage(websocketconnections.Reload, "")
+	if err != nil {
+		return err
+	}
+	return c.Send(message)
+}
+
+// Stop terminates the event stream. It can be called many times.
+func (c *Connection) Stop() error {
+	if !c.started.Load() {
+		return fmt.Errorf("(%s) failed to stop, so the connection is not started", c.UUID())
+	}
+
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+// Shutdown stops the connection. The event streams don't have a close frame, so the response is ended only.
+func (c *Connection) Shutdown() error {
+	return c.Stop()
+}
+
+// Configurer defines the configurable options to build a new Connection instance.
+type Configurer interface {
+	// ResponseWriter allows set the request response received by the client. It must implement [http.Flusher].
+	ResponseWriter(response http.ResponseWriter) error
+
+	// Request allows set the request instance received by the client.
+	Request(request *http.Request) error
+}
+
+// configurerPool implements [sseconnections.Configurer] interface.
+type configurerPool struct {
+	pool []func(c *Connection) error
+}
+
+// ResponseWriter implements [Configurer.ResponseWriter] method.
+func (cp *configurerPool) ResponseWriter(response http.ResponseWriter) error {
+
+	flusher, ok := response.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("response doesn't support flushing")
+	}
+
+	cp.pool = append(cp.pool, func(c *Connection) error {
+		c.response = response
+		c.flusher = flusher
+		return nil
+	})
+
+	return nil
+}
+
+// Request implements [Configurer.Request] method.
+func (cp *configurerPool) Request(request *http.Request) error {
+
+	cp.pool = append(cp.pool, func(c *Connection) error {
+		c.request = request
+		return nil
+	})
+
+	return nil
+}
+
+// New returns a [sseconnections.Connection] instance with request and response instanced configured.
+func New(options ...func(Configurer) error) (*Connection, error) {
+
+	configuration := &configurerPool{}
+	conn := &Connection{
+		uuid:     uuid.New(),
+		messages: make(chan websocketconnections.Message, queueSize),
+		done:     make(chan struct{}),
+	}
+
+	for _, option := range options {
+		err := option(configuration)
+		if err != nil {
+			return nil, fmt.Errorf("(%s) failed to prepare the configuration: %v", conn.UUID(), err)
+		}
+	}
+
+	for _, config := range configuration.pool {
+		err := config(conn)
+		if err != nil {
+			return nil, fmt.Errorf("(%s) failed to apply the configuration: %v", conn.UUID(), err)
+		}
+	}
+
+	if conn.request == nil {
+		return nil, fmt.Errorf("(%s) request is required", conn.UUID())
+	}
+
+	if conn.response == nil {
+		return nil, fmt.Errorf("(%s) response is required", conn.UUID())
+	}
+
+	return conn, nil
+}
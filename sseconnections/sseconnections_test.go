@@ -0,0 +1,129 @@
+package sseconnections
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauroalderete/pkgsite-local-live/websocketconnections"
+)
+
+// writerWithoutFlush is a response that doesn't implement http.Flusher.
+type writerWithoutFlush struct {
+	http.ResponseWriter
+}
+
+func TestNew(t *testing.T) {
+
+	t.Run("without request", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.ResponseWriter(httptest.NewRecorder())
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("without flusher", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.ResponseWriter(writerWithoutFlush{httptest.NewRecorder()})
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			err := c.Request(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != nil {
+				return err
+			}
+			return c.ResponseWriter(httptest.NewRecorder())
+		})
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+		}
+	})
+}
+
+func TestStart(t *testing.T) {
+	connections := make(chan *Connection, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := New(func(c Configurer) error {
+			err := c.Request(r)
+			if err != nil {
+				return err
+			}
+			return c.ResponseWriter(w)
+		})
+		if err != nil {
+			t.Errorf("failed to instance the connection: %v", err)
+			return
+		}
+
+		err = conn.Open()
+		if err != nil {
+			t.Errorf("failed to open the connection: %v", err)
+			return
+		}
+
+		connections <- conn
+		conn.Start()
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "?page=/example.com/a")
+	if err != nil {
+		t.Fatalf("failed to request the event stream: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("expected the event stream content type, got '%s'", response.Header.Get("Content-Type"))
+	}
+
+	var conn *Connection
+	select {
+	case conn = <-connections:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the connection opened")
+	}
+
+	if conn.Page() != "/example.com/a" || !conn.Viewing("/example.com/a") || conn.Viewing("/example.com/b") {
+		t.Errorf("expected the page /example.com/a, got '%s'", conn.Page())
+	}
+
+	err = conn.Reload()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	reader := bufio.NewReader(response.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected the reload event, got error '%v'", err)
+		}
+
+		if strings.HasPrefix(line, "data: ") {
+			expected := `data: {"version":1,"type":"reload"}`
+			if strings.TrimSpace(line) != expected {
+				t.Errorf("expected %s, got %s", expected, line)
+			}
+			break
+		}
+	}
+
+	conn.Shutdown()
+
+	message, _ := websocketconnections.NewMessage(websocketconnections.Reload, "")
+	err = conn.Send(message)
+	if err == nil {
+		t.Errorf("expected an error sending to a connection stopped, got error nil")
+	}
+}
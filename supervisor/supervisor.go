@@ -0,0 +1,459 @@
+// Package supervisor spawns and manages the lifecycle of the pkgsite process.
+//
+// It allows to start, stop and restart the child process from the reloader,
+// captures its output into the standard logger and reaps it when it terminates.
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// State describes the lifecycle stage of the supervised process.
+type State int
+
+const (
+	// Stopped is the state of a process that never was started or that was stopped by the supervisor.
+	Stopped State = iota
+
+	// Running is the state of a process started and alive.
+	Running
+
+	// Stopping is the state of a process that received the termination signal and is not reaped yet.
+	Stopping
+
+	// Exited is the state of a process that terminated by itself.
+	Exited
+
+	// Failed is the state of a process that couldn't be killed after the stop timeout. It could be alive yet.
+	Failed
+)
+
+// String returns a readable name of the state.
+func (s State) String() string {
+	switch s {
+	case Stopped:
+		return "stopped"
+	case Running:
+		return "running"
+	case Stopping:
+		return "stopping"
+	case Exited:
+		return "exited"
+	case Failed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Supervisor manages a pkgsite child process.
+type Supervisor struct {
+
+	// binary is the path to the pkgsite executable.
+	binary string
+
+	// args is the list of extra arguments passed to pkgsite.
+	args []string
+
+	// argsFunc computes the arguments that are appended each time that the process is started, as the modules to load.
+	argsFunc func() ([]string, error)
+
+	// port is the port where pkgsite must listen. If it is zero, the `-http` flag is not passed.
+	port int
+
+	// stopTimeout is the time to wait for the process to terminate after the interrupt signal before killing it.
+	stopTimeout time.Duration
+
+	mutex sync.Mutex
+	cmd   *exec.Cmd
+	state State
+
+	// done is closed when the current process is reaped.
+	done chan struct{}
+
+	// exitErr stores the result of the last process reaped.
+	exitErr error
+}
+
+// State returns the current state of the supervised process.
+func (s *Supervisor) State() State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state
+}
+
+// Pid returns the process id of the supervised process, or zero if it is not running.
+func (s *Supervisor) Pid() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cmd == nil || s.cmd.Process == nil || s.state != Running {
+		return 0
+	}
+
+	return s.cmd.Process.Pid
+}
+
+// Err returns the error of the last process reaped, if it terminated with a failure.
+func (s *Supervisor) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.exitErr
+}
+
+// Start spawns a new pkgsite process. Returns an error if a process is already alive.
+//
+// The arguments are computed without holding the lock, because the arguments function can take long,
+// as the discovery of the modules, and the state must be readable meanwhile.
+func (s *Supervisor) Start() error {
+	err := s.startable()
+	if err != nil {
+		return err
+	}
+
+	args, err := s.arguments()
+	if err != nil {
+		return fmt.Errorf("failed to prepare the pkgsite arguments: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// other start could run while the arguments were computed
+	if s.state == Running || s.state == Stopping {
+		return fmt.Errorf("pkgsite is already %s", s.state)
+	}
+
+	cmd := exec.Command(s.binary, args...)
+	cmd.Stdout = &logWriter{prefix: "pkgsite: "}
+	cmd.Stderr = &logWriter{prefix: "pkgsite: "}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start pkgsite: %v", err)
+	}
+
+	log.Printf("pkgsite started with pid %d\n", cmd.Process.Pid)
+
+	s.cmd = cmd
+	s.state = Running
+	s.exitErr = nil
+	s.done = make(chan struct{})
+
+	go s.reap(cmd, s.done)
+
+	return nil
+}
+
+// startable returns an error if a process is alive, so a new one can't be started.
+func (s *Supervisor) startable() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state == Running || s.state == Stopping {
+		return fmt.Errorf("pkgsite is already %s", s.state)
+	}
+
+	return nil
+}
+
+// Stop sends an interrupt signal to the pkgsite process and waits until it is reaped.
+//
+// If the process doesn't terminate before the stop timeout, it is killed.
+// If it can't be killed, the state is set to [supervisor.Failed] and an error is returned.
+// Stopping a process that isn't alive is not an error.
+func (s *Supervisor) Stop() error {
+	s.mutex.Lock()
+
+	if s.state != Running {
+		if s.state == Exited {
+			s.state = Stopped
+		}
+		s.mutex.Unlock()
+		return nil
+	}
+
+	s.state = Stopping
+	cmd := s.cmd
+	done := s.done
+	s.mutex.Unlock()
+
+	err := cmd.Process.Signal(os.Interrupt)
+	if err != nil {
+		log.Printf("failed to interrupt pkgsite, killing it: %v", err)
+		cmd.Process.Kill()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(s.stopTimeout):
+		{
+			log.Printf("pkgsite didn't terminate after %s, killing it", s.stopTimeout)
+			err := cmd.Process.Kill()
+			if err != nil && !errors.Is(err, os.ErrProcessDone) {
+				s.mutex.Lock()
+				if s.cmd == cmd && s.state == Stopping {
+					s.state = Failed
+					s.exitErr = err
+				}
+				s.mutex.Unlock()
+				return fmt.Errorf("failed to kill pkgsite: %v", err)
+			}
+			<-done
+		}
+	}
+
+	return nil
+}
+
+// Restart stops the pkgsite process if it is alive and starts a new one.
+func (s *Supervisor) Restart() error {
+	err := s.Stop()
+	if err != nil {
+		return fmt.Errorf("failed to stop pkgsite to restart it: %v", err)
+	}
+
+	err = s.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start pkgsite to restart it: %v", err)
+	}
+
+	return nil
+}
+
+// Done returns a channel that is closed when the current process is reaped.
+// Returns nil if the process never was started.
+func (s *Supervisor) Done() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.done
+}
+
+// reap waits for the process to terminate and updates the state.
+func (s *Supervisor) reap(cmd *exec.Cmd, done chan struct{}) {
+	err := cmd.Wait()
+
+	// the last line isn't ended if the process terminated abruptly, as with a panic
+	for _, w := range []io.Writer{cmd.Stdout, cmd.Stderr} {
+		if lw, ok := w.(*logWriter); ok {
+			lw.flush()
+		}
+	}
+
+	s.mutex.Lock()
+	if s.cmd != cmd {
+		// the process failed to stop and other one was started meanwhile
+		log.Printf("pkgsite with pid %d terminated: %v\n", cmd.Process.Pid, err)
+	} else if s.state == Stopping || s.state == Failed {
+		s.state = Stopped
+		log.Printf("pkgsite with pid %d stopped\n", cmd.Process.Pid)
+	} else {
+		s.state = Exited
+		s.exitErr = err
+		log.Printf("pkgsite with pid %d exited: %v\n", cmd.Process.Pid, err)
+	}
+	s.mutex.Unlock()
+
+	close(done)
+}
+
+// arguments returns the list of arguments passed to the pkgsite process.
+func (s *Supervisor) arguments() ([]string, error) {
+	args := make([]string, 0, len(s.args)+2)
+
+	if s.port != 0 {
+		args = append(args, "-http", "localhost:"+strconv.Itoa(s.port))
+	}
+
+	args = append(args, s.args...)
+
+	if s.argsFunc == nil {
+		return args, nil
+	}
+
+	extra, err := s.argsFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(args, extra...), nil
+}
+
+// logWriter writes each line received into the standard logger.
+type logWriter struct {
+	prefix string
+	buffer []byte
+}
+
+// Write implements [io.Writer] interface. The incomplete lines are retained until the next write.
+func (lw *logWriter) Write(p []byte) (int, error) {
+	lw.buffer = append(lw.buffer, p...)
+
+	for {
+		i := bytes.IndexByte(lw.buffer, '\n')
+		if i < 0 {
+			break
+		}
+
+		log.Printf("%s%s", lw.prefix, lw.buffer[:i])
+		lw.buffer = lw.buffer[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// flush writes the incomplete line retained into the standard logger, if there is one.
+func (lw *logWriter) flush() {
+	if len(lw.buffer) == 0 {
+		return
+	}
+
+	log.Printf("%s%s", lw.prefix, lw.buffer)
+	lw.buffer = nil
+}
+
+// Configurer defines the configurable options to build a new instance of [supervisor.Supervisor].
+type Configurer interface {
+
+	// Binary sets the path to the pkgsite executable.
+	Binary(path string) error
+
+	// Args sets the extra arguments passed to pkgsite, as the list of module directories.
+	Args(args ...string) error
+
+	// ArgsFunc sets a function that computes arguments appended each time that pkgsite is started.
+	// It allows to refresh the list of modules to load in each restart.
+	ArgsFunc(argsFunc func() ([]string, error)) error
+
+	// Port sets the port where pkgsite must listen.
+	Port(port int) error
+
+	// StopTimeout sets the time to wait for pkgsite to terminate before killing it.
+	StopTimeout(timeout time.Duration) error
+}
+
+// configurer implements the [supervisor.Configurer] interface.
+type configurer struct {
+	pool []func(*Supervisor) error
+}
+
+// Binary implements [supervisor.Configurer.Binary] method.
+func (c *configurer) Binary(path string) error {
+
+	if len(path) == 0 {
+		return fmt.Errorf("binary path cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(s *Supervisor) error {
+		binary, err := exec.LookPath(path)
+		if err != nil {
+			return fmt.Errorf("failed to find the binary %s: %v", path, err)
+		}
+
+		s.binary = binary
+		return nil
+	})
+
+	return nil
+}
+
+// Args implements [supervisor.Configurer.Args] method.
+func (c *configurer) Args(args ...string) error {
+
+	c.pool = append(c.pool, func(s *Supervisor) error {
+		s.args = append(s.args, args...)
+		return nil
+	})
+
+	return nil
+}
+
+// ArgsFunc implements [supervisor.Configurer.ArgsFunc] method.
+func (c *configurer) ArgsFunc(argsFunc func() ([]string, error)) error {
+
+	if argsFunc == nil {
+		return fmt.Errorf("args function cannot be nil")
+	}
+
+	c.pool = append(c.pool, func(s *Supervisor) error {
+		s.argsFunc = argsFunc
+		return nil
+	})
+
+	return nil
+}
+
+// Port implements [supervisor.Configurer.Port] method.
+func (c *configurer) Port(port int) error {
+
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("port %d is out of range", port)
+	}
+
+	c.pool = append(c.pool, func(s *Supervisor) error {
+		s.port = port
+		return nil
+	})
+
+	return nil
+}
+
+// StopTimeout implements [supervisor.Configurer.StopTimeout] method.
+func (c *configurer) StopTimeout(timeout time.Duration) error {
+
+	if timeout <= 0 {
+		return fmt.Errorf("stop timeout must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(s *Supervisor) error {
+		s.stopTimeout = timeout
+		return nil
+	})
+
+	return nil
+}
+
+// New returns a new [supervisor.Supervisor] instance configured. The process isn't started.
+//
+// Receives a list of options callback with the configurations to apply.
+// By default, the process has 5 seconds to terminate when it is stopped.
+func New(options ...func(Configurer) error) (*Supervisor, error) {
+
+	configurer := &configurer{}
+
+	for _, option := range options {
+		err := option(configurer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load options: %v", err)
+		}
+	}
+
+	supervisor := &Supervisor{
+		stopTimeout: 5 * time.Second,
+	}
+
+	for _, config := range configurer.pool {
+		err := config(supervisor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply options: %v", err)
+		}
+	}
+
+	if len(supervisor.binary) == 0 {
+		return nil, fmt.Errorf("binary is required")
+	}
+
+	return supervisor, nil
+}
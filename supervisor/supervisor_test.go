@@ -0,0 +1,352 @@
+package supervisor
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess is not a real test, it is the fake pkgsite executed by the supervisor in the tests.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("SUPERVISOR_HELPER")
+	if mode == "" {
+		return
+	}
+
+	fmt.Println("helper running")
+
+	switch mode {
+	case "exit":
+		os.Exit(1)
+	case "fatal":
+		fmt.Print("fatal error without newline")
+		os.Exit(2)
+	case "ignore":
+		signal.Ignore(os.Interrupt)
+	}
+
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+// newHelper returns a supervisor that runs the test binary as fake pkgsite.
+func newHelper(t *testing.T, mode string) *Supervisor {
+	t.Setenv("SUPERVISOR_HELPER", mode)
+
+	s, err := New(func(c Configurer) error {
+		err := c.Binary(os.Args[0])
+		if err != nil {
+			return err
+		}
+		err = c.Args("-test.run=TestHelperProcess")
+		if err != nil {
+			return err
+		}
+		return c.StopTimeout(500 * time.Millisecond)
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the supervisor: %v", err)
+	}
+
+	return s
+}
+
+func TestNew(t *testing.T) {
+
+	t.Run("without binary", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("binary not found", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.Binary("some-binary-that-not-exists")
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("port wrong", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.Port(70000)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("arguments", func(t *testing.T) {
+		s, err := New(func(c Configurer) error {
+			err := c.Binary(os.Args[0])
+			if err != nil {
+				return err
+			}
+			err = c.Port(3000)
+			if err != nil {
+				return err
+			}
+			err = c.Args("-dev")
+			if err != nil {
+				return err
+			}
+			return c.ArgsFunc(func() ([]string, error) {
+				return []string{"/go/src/a,/go/src/b"}, nil
+			})
+		})
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+			return
+		}
+
+		args, err := s.arguments()
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+			return
+		}
+
+		expected := fmt.Sprint([]string{"-http", "localhost:3000", "-dev", "/go/src/a,/go/src/b"})
+		got := fmt.Sprint(args)
+		if expected != got {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("arguments failed", func(t *testing.T) {
+		s, err := New(func(c Configurer) error {
+			err := c.Binary(os.Args[0])
+			if err != nil {
+				return err
+			}
+			return c.ArgsFunc(func() ([]string, error) {
+				return nil, fmt.Errorf("no modules found")
+			})
+		})
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+			return
+		}
+
+		err = s.Start()
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+func TestLifecycle(t *testing.T) {
+	s := newHelper(t, "sleep")
+
+	if s.State() != Stopped {
+		t.Errorf("expected %s, got %s", Stopped, s.State())
+	}
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	if s.State() != Running || s.Pid() == 0 {
+		t.Errorf("expected %s with pid, got %s with pid %d", Running, s.State(), s.Pid())
+	}
+
+	err = s.Start()
+	if err == nil {
+		t.Errorf("expected an error starting twice, got error nil")
+	}
+
+	pid := s.Pid()
+	err = s.Restart()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	if s.Pid() == pid {
+		t.Errorf("expected a new process, got the same pid %d", pid)
+	}
+
+	err = s.Stop()
+	if err != nil {
+		t.Errorf("expected error nil, got '%v'", err)
+	}
+
+	if s.State() != Stopped {
+		t.Errorf("expected %s, got %s", Stopped, s.State())
+	}
+
+	err = s.Stop()
+	if err != nil {
+		t.Errorf("expected error nil stopping twice, got '%v'", err)
+	}
+}
+
+func TestStopKill(t *testing.T) {
+	s := newHelper(t, "ignore")
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	// gives time to the helper to ignore the signal
+	time.Sleep(200 * time.Millisecond)
+
+	err = s.Stop()
+	if err != nil {
+		t.Errorf("expected error nil, got '%v'", err)
+	}
+
+	if s.State() != Stopped {
+		t.Errorf("expected %s, got %s", Stopped, s.State())
+	}
+}
+
+func TestExited(t *testing.T) {
+	s := newHelper(t, "exit")
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the process reaped, got timeout")
+	}
+
+	if s.State() != Exited || s.Err() == nil {
+		t.Errorf("expected %s with an error, got %s with '%v'", Exited, s.State(), s.Err())
+	}
+
+	err = s.Start()
+	if err != nil {
+		t.Errorf("expected error nil starting after exit, got '%v'", err)
+	}
+	s.Stop()
+}
+
+func TestStartArgsUnlocked(t *testing.T) {
+	t.Setenv("SUPERVISOR_HELPER", "run")
+
+	computing := make(chan struct{})
+	release := make(chan struct{})
+
+	s, err := New(func(c Configurer) error {
+		err := c.Binary(os.Args[0])
+		if err != nil {
+			return err
+		}
+		err = c.Args("-test.run=TestHelperProcess")
+		if err != nil {
+			return err
+		}
+		return c.ArgsFunc(func() ([]string, error) {
+			close(computing)
+			<-release
+			return nil, nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the supervisor: %v", err)
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- s.Start()
+	}()
+
+	<-computing
+
+	// the state is readable while the arguments are computed
+	state := make(chan State, 1)
+	go func() {
+		state <- s.State()
+	}()
+
+	select {
+	case got := <-state:
+		if got != Stopped {
+			t.Errorf("expected %s, got %s", Stopped, got)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the state read, got blocked by the arguments function")
+	}
+
+	close(release)
+
+	err = <-started
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+	s.Stop()
+}
+
+func TestExitedWithoutNewline(t *testing.T) {
+	output := &bytes.Buffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	s := newHelper(t, "fatal")
+
+	err := s.Start()
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the process reaped, got timeout")
+	}
+
+	if !strings.Contains(output.String(), "pkgsite: fatal error without newline") {
+		t.Errorf("expected the last line logged, got '%s'", output.String())
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	lw := &logWriter{prefix: "test: "}
+
+	n, err := lw.Write([]byte("first line\nsecond "))
+	if err != nil || n != 18 {
+		t.Errorf("expected 18 bytes written, got %d and '%v'", n, err)
+	}
+
+	expected := "second "
+	if string(lw.buffer) != expected {
+		t.Errorf("expected '%s' retained, got '%s'", expected, lw.buffer)
+	}
+
+	lw.Write([]byte("line\n"))
+	if len(lw.buffer) != 0 {
+		t.Errorf("expected buffer empty, got '%s'", lw.buffer)
+	}
+
+	t.Run("flush", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		log.SetOutput(output)
+		defer log.SetOutput(os.Stderr)
+
+		lw := &logWriter{prefix: "test: "}
+		lw.Write([]byte("panic: without newline"))
+		lw.flush()
+
+		if !strings.Contains(output.String(), "test: panic: without newline") {
+			t.Errorf("expected the incomplete line logged, got '%s'", output.String())
+		}
+
+		if len(lw.buffer) != 0 {
+			t.Errorf("expected buffer empty, got '%s'", lw.buffer)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+//go:build linux
+
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask is the set of inotify events that the backend subscribes for each directory.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+// inotifyBackend receives the changes from the kernel through an inotify instance.
+//
+// inotify is not recursive, so a watch is added for each directory of the tree
+// and for each new directory created while it is running.
+type inotifyBackend struct {
+	root string
+	fd   int
+	file *os.File
+
+	mutex   sync.Mutex
+	watches map[int32]string
+}
+
+// newNativeBackend returns an inotify backend ready to run.
+func newNativeBackend(w *Watcher) (backend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %v", err)
+	}
+
+	// a non blocking descriptor wrapped in an os.File uses the runtime poller,
+	// so closing the file unblocks a pending read. The descriptor is kept apart
+	// because os.File.Fd switches the file to blocking mode.
+	b := &inotifyBackend{
+		root:    w.root,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32]string),
+	}
+
+	err = b.addTree(w.root)
+	if err != nil {
+		b.file.Close()
+		return nil, err
+	}
+
+	// the extra files are observed through their parent directory
+	for _, path := range w.files {
+		dir := filepath.Dir(path)
+		if within(w.root, dir) {
+			continue
+		}
+
+		err = b.add(dir)
+		if err != nil {
+			b.file.Close()
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// addTree adds a watch for each directory under path.
+func (b *inotifyBackend) addTree(path string) error {
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if skipDir(b.root, p) {
+			return filepath.SkipDir
+		}
+
+		return b.add(p)
+	})
+}
+
+// add adds a watch for a directory.
+func (b *inotifyBackend) add(path string) error {
+	wd, err := syscall.InotifyAddWatch(b.fd, path, inotifyMask)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+			return nil
+		}
+		return fmt.Errorf("failed to watch %s: %v", path, err)
+	}
+
+	b.mutex.Lock()
+	b.watches[int32(wd)] = path
+	b.mutex.Unlock()
+
+	return nil
+}
+
+// run implements the backend interface.
+//
+// The inotify descriptor is closed when the read loop exits, whatever the reason.
+func (b *inotifyBackend) run(stop <-chan struct{}, events chan<- Event) error {
+	finished := make(chan struct{})
+	defer close(finished)
+	defer b.file.Close()
+
+	// closing the file unblocks the pending read when the watcher is stopped
+	go func() {
+		select {
+		case <-stop:
+			b.file.Close()
+		case <-finished:
+		}
+	}()
+
+	buffer := make([]byte, syscall.SizeofInotifyEvent*4096)
+
+	for {
+		n, err := b.file.Read(buffer)
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return fmt.Errorf("failed to read inotify events: %v", err)
+			}
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameBytes := buffer[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(raw.Len)]
+			offset += syscall.SizeofInotifyEvent + int(raw.Len)
+
+			for _, event := range b.translate(raw, string(trimNull(nameBytes))) {
+				select {
+				case events <- event:
+				case <-stop:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// translate converts an inotify event into the [watcher.Event] list that it represents.
+//
+// Returns nil if the event must be ignored, as the events over directories.
+// When a directory is created or moved into the tree, its files already present are reported as created,
+// because they could be written before its watch is added, as with `cp -r` or `git checkout`.
+func (b *inotifyBackend) translate(raw *syscall.InotifyEvent, name string) []Event {
+	b.mutex.Lock()
+	dir, ok := b.watches[raw.Wd]
+	if raw.Mask&(syscall.IN_IGNORED|syscall.IN_DELETE_SELF) != 0 {
+		delete(b.watches, raw.Wd)
+	}
+	b.mutex.Unlock()
+
+	if !ok || len(name) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(dir, name)
+
+	if raw.Mask&syscall.IN_ISDIR != 0 {
+		if raw.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 || skipDir(b.root, path) {
+			return nil
+		}
+
+		// the watches are added before the walk, so no file is missed between both
+		b.addTree(path)
+		return b.existing(path)
+	}
+
+	switch {
+	case raw.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		return []Event{{Path: path, Op: Create}}
+	case raw.Mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0:
+		return []Event{{Path: path, Op: Write}}
+	case raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		return []Event{{Path: path, Op: Remove}}
+	}
+
+	return nil
+}
+
+// existing returns a create event for each file found under path, skipping the same directories than [watcher.inotifyBackend.addTree].
+func (b *inotifyBackend) existing(path string) []Event {
+	events := []Event{}
+
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if skipDir(b.root, p) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		events = append(events, Event{Path: p, Op: Create})
+		return nil
+	})
+
+	return events
+}
+
+// trimNull removes the null padding that inotify adds to the names.
+func trimNull(name []byte) []byte {
+	for i, c := range name {
+		if c == 0 {
+			return name[:i]
+		}
+	}
+	return name
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watcher
+
+import "fmt"
+
+// newNativeBackend is not supported on this platform, the polling backend is used instead.
+func newNativeBackend(w *Watcher) (backend, error) {
+	return nil, fmt.Errorf("native backend not supported on this platform")
+}
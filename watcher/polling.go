@@ -0,0 +1,132 @@
+package watcher
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileState stores the attributes of a file used to detect if it was modified.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// pollingBackend walks the tree periodically and compares the state of the files with the previous walk.
+type pollingBackend struct {
+	root     string
+	files    []string
+	interval time.Duration
+}
+
+// newPollingBackend returns a pollingBackend that observes the root of the watcher.
+func newPollingBackend(w *Watcher) *pollingBackend {
+	return &pollingBackend{
+		root:     w.root,
+		files:    w.files,
+		interval: w.interval,
+	}
+}
+
+// run implements the backend interface.
+func (p *pollingBackend) run(stop <-chan struct{}, events chan<- Event) error {
+
+	previous, err := p.snapshot()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			{
+				current, err := p.snapshot()
+				if err != nil {
+					return err
+				}
+
+				for _, event := range compare(previous, current) {
+					select {
+					case events <- event:
+					case <-stop:
+						return nil
+					}
+				}
+
+				previous = current
+			}
+		}
+	}
+}
+
+// snapshot walks the tree and returns the state of each file found.
+func (p *pollingBackend) snapshot() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+
+	err := filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the file could be removed during the walk
+			return nil
+		}
+
+		if d.IsDir() {
+			if skipDir(p.root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range p.files {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return files, nil
+}
+
+// compare returns the events needed to transform the previous state into the current one.
+func compare(previous, current map[string]fileState) []Event {
+	events := make([]Event, 0)
+
+	for path, state := range current {
+		old, ok := previous[path]
+		if !ok {
+			events = append(events, Event{Path: path, Op: Create})
+			continue
+		}
+
+		if !old.modTime.Equal(state.modTime) || old.size != state.size {
+			events = append(events, Event{Path: path, Op: Write})
+		}
+	}
+
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			events = append(events, Event{Path: path, Op: Remove})
+		}
+	}
+
+	return events
+}
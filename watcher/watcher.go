@@ -0,0 +1,356 @@
+// Package watcher observes a directory tree and notifies when the files that contains are created, modified or removed.
+//
+// On Linux it uses inotify to receive the events from the kernel. On the rest of the platforms,
+// or when it is requested explicitly, it walks the directory tree periodically to compare the state of the files.
+package watcher
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Op describes the kind of change detected over a file.
+type Op uint32
+
+const (
+	// Create is reported when a new file appears in the tree.
+	Create Op = 1 << iota
+
+	// Write is reported when the content of a file is modified.
+	Write
+
+	// Remove is reported when a file is deleted or moved out of the tree.
+	Remove
+)
+
+// String returns a readable name of the operation.
+func (o Op) String() string {
+	switch o {
+	case Create:
+		return "create"
+	case Write:
+		return "write"
+	case Remove:
+		return "remove"
+	default:
+		return "unknown"
+	}
+}
+
+// Event models a change detected over a file.
+type Event struct {
+
+	// Path is the path of the file changed.
+	Path string
+
+	// Op is the kind of change.
+	Op Op
+}
+
+// Handler defines a function that receives a batch of events detected during an interval.
+type Handler func([]Event)
+
+// backend defines the mechanism used to detect the changes over the tree.
+type backend interface {
+
+	// run sends the changes detected into events until stop is closed.
+	run(stop <-chan struct{}, events chan<- Event) error
+}
+
+// Watcher observes a directory tree and calls a [watcher.Handler] with the changes detected.
+//
+// The events are grouped during an interval to avoid launching many times the handler
+// when a tool writes many files at once.
+type Watcher struct {
+
+	// root is the directory observed.
+	root string
+
+	// extensions is the list of file extensions, without dot, that are considered. If it is empty, any file is considered.
+	extensions []string
+
+	// files is the list of extra files observed, although they are outside of the root or have other extension.
+	files []string
+
+	// interval is the time that the events are grouped, and the frequency of the walks when the polling is used.
+	interval time.Duration
+
+	// polling forces to use the polling backend although a native backend is available.
+	polling bool
+
+	// stop is closed to terminate the execution of the watcher.
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Root returns the directory observed.
+func (w *Watcher) Root() string {
+	return w.root
+}
+
+// Run starts to observe the tree and calls handler each time that changes are detected.
+//
+// This method is blocked until [watcher.Watcher.Stop] is called or the backend fails.
+func (w *Watcher) Run(handler Handler) error {
+
+	if handler == nil {
+		return fmt.Errorf("handler cannot be nil")
+	}
+
+	var b backend
+	if w.polling {
+		b = newPollingBackend(w)
+	} else {
+		native, err := newNativeBackend(w)
+		if err != nil {
+			log.Printf("native watcher is not available, using polling instead: %v", err)
+			b = newPollingBackend(w)
+		} else {
+			b = native
+		}
+	}
+
+	events := make(chan Event)
+	fail := make(chan error, 1)
+
+	go func() {
+		fail <- b.run(w.stop, events)
+	}()
+
+	pending := make([]Event, 0)
+	timer := time.NewTimer(w.interval)
+	timer.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			{
+				if !w.accept(event.Path) {
+					continue
+				}
+
+				if len(pending) == 0 {
+					timer.Reset(w.interval)
+				}
+				pending = append(pending, event)
+			}
+		case <-timer.C:
+			{
+				handler(pending)
+				pending = make([]Event, 0)
+			}
+		case err := <-fail:
+			{
+				timer.Stop()
+				if err != nil {
+					return fmt.Errorf("watcher of %s failed: %v", w.root, err)
+				}
+				return nil
+			}
+		}
+	}
+}
+
+// Stop terminates the observation of the tree. It can be called many times.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// accept validates if a path is one of the extra files or if it is inside of the root and has one of the extensions configured.
+func (w *Watcher) accept(path string) bool {
+	for _, f := range w.files {
+		if f == path {
+			return true
+		}
+	}
+
+	if !within(w.root, path) {
+		return false
+	}
+
+	if len(w.extensions) == 0 {
+		return true
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	for _, e := range w.extensions {
+		if e == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// within validates if path is inside of the root directory.
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// skipDir validates if a directory must be ignored, as the hidden folders like `.git`.
+func skipDir(root string, path string) bool {
+	if path == root {
+		return false
+	}
+
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// Configurer defines the configurable options to build a new instance of [watcher.Watcher].
+type Configurer interface {
+
+	// Root sets the directory to observe.
+	Root(path string) error
+
+	// Extensions sets the file extensions, without the dot, that must be considered.
+	Extensions(extensions ...string) error
+
+	// Files sets extra files to observe, although they are outside of the root or have other extension.
+	Files(paths ...string) error
+
+	// Interval sets the time that the events are grouped before to call the handler.
+	// It is used as frequency of the walks too when the polling backend is used.
+	Interval(interval time.Duration) error
+
+	// Polling forces to use the polling backend.
+	Polling(enable bool) error
+}
+
+// configurer implements the [watcher.Configurer] interface.
+type configurer struct {
+	pool []func(*Watcher) error
+}
+
+// Root implements [watcher.Configurer.Root] method.
+func (c *configurer) Root(path string) error {
+
+	if len(path) == 0 {
+		return fmt.Errorf("root path cannot be empty")
+	}
+
+	c.pool = append(c.pool, func(w *Watcher) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to access to root %s: %v", path, err)
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("root %s must be a directory", path)
+		}
+
+		root, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the root %s: %v", path, err)
+		}
+
+		w.root = root
+		return nil
+	})
+
+	return nil
+}
+
+// Extensions implements [watcher.Configurer.Extensions] method.
+func (c *configurer) Extensions(extensions ...string) error {
+
+	c.pool = append(c.pool, func(w *Watcher) error {
+		for _, e := range extensions {
+			e = strings.TrimPrefix(strings.TrimSpace(e), ".")
+			if len(e) > 0 {
+				w.extensions = append(w.extensions, e)
+			}
+		}
+		return nil
+	})
+
+	return nil
+}
+
+// Files implements [watcher.Configurer.Files] method.
+func (c *configurer) Files(paths ...string) error {
+
+	c.pool = append(c.pool, func(w *Watcher) error {
+		for _, p := range paths {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return fmt.Errorf("failed to resolve the path %s: %v", p, err)
+			}
+			w.files = append(w.files, abs)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+// Interval implements [watcher.Configurer.Interval] method.
+func (c *configurer) Interval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(w *Watcher) error {
+		w.interval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// Polling implements [watcher.Configurer.Polling] method.
+func (c *configurer) Polling(enable bool) error {
+
+	c.pool = append(c.pool, func(w *Watcher) error {
+		w.polling = enable
+		return nil
+	})
+
+	return nil
+}
+
+// New returns a new [watcher.Watcher] instance configured.
+//
+// Receives a list of options callback with the configurations to apply.
+// By default, the events are grouped during 500 milliseconds.
+func New(options ...func(Configurer) error) (*Watcher, error) {
+
+	configurer := &configurer{}
+
+	for _, option := range options {
+		err := option(configurer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load options: %v", err)
+		}
+	}
+
+	watcher := &Watcher{
+		interval: 500 * time.Millisecond,
+		stop:     make(chan struct{}),
+	}
+
+	for _, config := range configurer.pool {
+		err := config(watcher)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply options: %v", err)
+		}
+	}
+
+	if len(watcher.root) == 0 {
+		return nil, fmt.Errorf("root is required")
+	}
+
+	return watcher, nil
+}
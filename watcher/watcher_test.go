@@ -0,0 +1,274 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+
+	t.Run("without root", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("root empty", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.Root("")
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("root not exists", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.Root(filepath.Join(t.TempDir(), "missing"))
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("interval wrong", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.Interval(0)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		w, err := New(func(c Configurer) error {
+			err := c.Root(t.TempDir())
+			if err != nil {
+				return err
+			}
+			return c.Extensions("go", ".md", "")
+		})
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+			return
+		}
+
+		expected := 2
+		if len(w.extensions) != expected {
+			t.Errorf("expected %d extensions, got %v", expected, w.extensions)
+		}
+	})
+}
+
+func TestAccept(t *testing.T) {
+	cases := map[string]struct {
+		extensions []string
+		path       string
+		expected   bool
+	}{
+		"any":       {nil, "/a/b.txt", true},
+		"go":        {[]string{"go", "md"}, "/a/b.go", true},
+		"md":        {[]string{"go", "md"}, "/a/README.md", true},
+		"other":     {[]string{"go", "md"}, "/a/b.txt", false},
+		"without":   {[]string{"go", "md"}, "/a/Makefile", false},
+		"go suffix": {[]string{"go"}, "/a/b.mgo", false},
+		"outside":   {[]string{"go"}, "/b/c.go", false},
+		"sibling":   {nil, "/ab/c.go", false},
+		"file":      {[]string{"go"}, "/config/modules.yml", true},
+	}
+
+	for n, c := range cases {
+		t.Run(n, func(t *testing.T) {
+			w := &Watcher{root: "/a", extensions: c.extensions, files: []string{"/config/modules.yml"}}
+			if w.accept(c.path) != c.expected {
+				t.Errorf("expected %v, got %v", c.expected, !c.expected)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	now := time.Now()
+
+	previous := map[string]fileState{
+		"same":     {now, 1},
+		"modified": {now, 1},
+		"removed":  {now, 1},
+	}
+	current := map[string]fileState{
+		"same":     {now, 1},
+		"modified": {now.Add(time.Second), 1},
+		"created":  {now, 1},
+	}
+
+	expected := map[string]Op{
+		"modified": Write,
+		"removed":  Remove,
+		"created":  Create,
+	}
+
+	events := compare(previous, current)
+	if len(events) != len(expected) {
+		t.Errorf("expected %d events, got %v", len(expected), events)
+		return
+	}
+
+	for _, e := range events {
+		if expected[e.Path] != e.Op {
+			t.Errorf("expected %s for %s, got %s", expected[e.Path], e.Path, e.Op)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	cases := map[string]bool{
+		"native":  false,
+		"polling": true,
+	}
+
+	for n, polling := range cases {
+		t.Run(n, func(t *testing.T) {
+			root := t.TempDir()
+			err := os.Mkdir(filepath.Join(root, "pkg"), 0o755)
+			if err != nil {
+				t.Fatalf("failed to prepare the tree: %v", err)
+			}
+
+			w, err := New(func(c Configurer) error {
+				err := c.Root(root)
+				if err != nil {
+					return err
+				}
+				err = c.Extensions("go")
+				if err != nil {
+					return err
+				}
+				err = c.Interval(50 * time.Millisecond)
+				if err != nil {
+					return err
+				}
+				return c.Polling(polling)
+			})
+			if err != nil {
+				t.Fatalf("failed to instance the watcher: %v", err)
+			}
+
+			batches := make(chan []Event, 10)
+			done := make(chan error)
+			go func() {
+				done <- w.Run(func(events []Event) { batches <- events })
+			}()
+
+			// gives time to the backend to take the first snapshot
+			time.Sleep(100 * time.Millisecond)
+
+			target := filepath.Join(root, "pkg", "file.go")
+			err = os.WriteFile(filepath.Join(root, "pkg", "file.txt"), []byte("ignored"), 0o644)
+			if err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			err = os.WriteFile(target, []byte("package pkg"), 0o644)
+			if err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			select {
+			case events := <-batches:
+				for _, e := range events {
+					if e.Path != target {
+						t.Errorf("expected events only of %s, got %s", target, e.Path)
+					}
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("expected a batch of events, got timeout")
+			}
+
+			w.Stop()
+			w.Stop()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("expected error nil, got '%v'", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("expected the watcher stopped, got timeout")
+			}
+		})
+	}
+}
+
+func TestRunDirectoryMoved(t *testing.T) {
+	cases := map[string]bool{
+		"native":  false,
+		"polling": true,
+	}
+
+	for n, polling := range cases {
+		t.Run(n, func(t *testing.T) {
+			root := t.TempDir()
+
+			// the directory is prepared outside of the root, to move it with its files in a single step
+			outside := t.TempDir()
+			err := os.MkdirAll(filepath.Join(outside, "pkg", "sub"), 0o755)
+			if err != nil {
+				t.Fatalf("failed to prepare the tree: %v", err)
+			}
+			err = os.WriteFile(filepath.Join(outside, "pkg", "sub", "file.go"), []byte("package sub"), 0o644)
+			if err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			w, err := New(func(c Configurer) error {
+				err := c.Root(root)
+				if err != nil {
+					return err
+				}
+				err = c.Extensions("go")
+				if err != nil {
+					return err
+				}
+				err = c.Interval(50 * time.Millisecond)
+				if err != nil {
+					return err
+				}
+				return c.Polling(polling)
+			})
+			if err != nil {
+				t.Fatalf("failed to instance the watcher: %v", err)
+			}
+			defer w.Stop()
+
+			batches := make(chan []Event, 10)
+			go w.Run(func(events []Event) { batches <- events })
+
+			// gives time to the backend to take the first snapshot
+			time.Sleep(100 * time.Millisecond)
+
+			err = os.Rename(filepath.Join(outside, "pkg"), filepath.Join(root, "pkg"))
+			if err != nil {
+				t.Fatalf("failed to move the directory: %v", err)
+			}
+
+			target := filepath.Join(root, "pkg", "sub", "file.go")
+
+			select {
+			case events := <-batches:
+				found := false
+				for _, e := range events {
+					found = found || (e.Path == target && e.Op == Create)
+				}
+				if !found {
+					t.Errorf("expected the creation of %s, got %v", target, events)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("expected a batch of events, got timeout")
+			}
+		})
+	}
+}
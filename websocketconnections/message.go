@@ -0,0 +1,68 @@
+package websocketconnections
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the version of the messages sent to the clients.
+//
+// It is increased when a change in the messages breaks the clients that already understand them.
+const ProtocolVersion = 1
+
+// MessageType identifies the action that the client must do when it receives a message.
+type MessageType string
+
+const (
+	// Reload asks the client to reload the whole page.
+	Reload MessageType = "reload"
+
+	// CSS asks the client to reload only the stylesheets, without losing the state of the page.
+	CSS MessageType = "css"
+
+	// Error notifies the client that something failed, as the build of the documentation.
+	// The text of the message describes the error.
+	Error MessageType = "error"
+
+	// Status notifies the client about the progress of the server, as a restart in course.
+	// The text of the message describes the status.
+	Status MessageType = "status"
+)
+
+// Valid returns true if the type is one of the known by the protocol.
+func (t MessageType) Valid() bool {
+	switch t {
+	case Reload, CSS, Error, Status:
+		return true
+	}
+	return false
+}
+
+// Message is the JSON object sent to the clients through the websocket, as
+//
+//	{"version":1,"type":"status","text":"restarting pkgsite"}
+type Message struct {
+	Version int         `json:"version"`
+	Type    MessageType `json:"type"`
+	Text    string      `json:"text,omitempty"`
+}
+
+// NewMessage returns a [websocketconnections.Message] of the current protocol version.
+//
+// Returns an error if the type is unknown.
+func NewMessage(t MessageType, text string) (Message, error) {
+	if !t.Valid() {
+		return Message{}, fmt.Errorf("unknown message type '%s'", t)
+	}
+
+	return Message{
+		Version: ProtocolVersion,
+		Type:    t,
+		Text:    text,
+	}, nil
+}
+
+// Encode returns the JSON representation of the message.
+func (m Message) Encode() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -0,0 +1,248 @@
+package websocketconnections
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AllowAll is the origin pattern that accepts the requests of any origin, even without the Origin header.
+const AllowAll = "*"
+
+// SameHost is the origin pattern that accepts the requests whose origin has the same host and port
+// used in the request to reach the server, as when the page that opens the websocket was served by the same server.
+//
+// The scheme isn't compared, because the server doesn't know the one used by the browser if a proxy terminates TLS.
+// So if the request doesn't have the port, the default ports of both http and https are accepted.
+const SameHost = "same-host"
+
+// Public is the origin pattern that accepts the requests whose origin has the same scheme, host and port
+// of the public address of the server, as the pages served through the public url of the reverse proxy.
+const Public = "public"
+
+// DefaultOrigins are the patterns of the origin policy used when it isn't configured.
+// They accept the pages served by localhost, by the public address and by the same host of the request.
+var DefaultOrigins = []string{"http://localhost", Public, SameHost}
+
+// OriginPolicy decides which origins can open a websocket connection.
+//
+// It is built from a list of patterns, and an origin is accepted if it matches any of them.
+// Besides [websocketconnections.AllowAll], [websocketconnections.Public] and [websocketconnections.SameHost], a pattern is an address
+// as `[scheme://]host[:port]`, where the host can start with `*.` to match any subdomain,
+// or be `*` to match any host. Without scheme or port, any scheme or port is matched.
+type OriginPolicy struct {
+	patterns []string
+	allowAll bool
+	public   bool
+	sameHost bool
+	rules    []originRule
+}
+
+// originRule is an address pattern parsed. The empty fields match any value.
+type originRule struct {
+	scheme string
+	host   string
+
+	// subdomains is true if the host pattern started with `*.`, so the host stored is the parent domain.
+	subdomains bool
+	port       string
+}
+
+// NewOriginPolicy returns a [websocketconnections.OriginPolicy] that accepts the origins that match any of the patterns.
+//
+// Returns an error if there aren't patterns or some of them is invalid.
+func NewOriginPolicy(patterns ...string) (*OriginPolicy, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("origin policy requires at least one pattern")
+	}
+
+	policy := &OriginPolicy{}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+
+		switch strings.ToLower(pattern) {
+		case AllowAll:
+			policy.allowAll = true
+		case Public:
+			policy.public = true
+		case SameHost:
+			policy.sameHost = true
+		default:
+			rule, err := parseOriginRule(pattern)
+			if err != nil {
+				return nil, err
+			}
+			policy.rules = append(policy.rules, rule)
+		}
+
+		policy.patterns = append(policy.patterns, pattern)
+	}
+
+	return policy, nil
+}
+
+// String returns the patterns of the policy.
+func (p *OriginPolicy) String() string {
+	return strings.Join(p.patterns, ", ")
+}
+
+// Allow returns true if the origin of the request is accepted by the policy.
+//
+// The public address is the one matched by the [websocketconnections.Public] pattern. If it is nil, the pattern matches nothing.
+// The requests without the Origin header, that don't come from a browser, are accepted only if all origins are allowed.
+func (p *OriginPolicy) Allow(r *http.Request, public *url.URL) bool {
+	if p.allowAll {
+		return true
+	}
+
+	values := r.Header.Values("Origin")
+	if len(values) != 1 {
+		return false
+	}
+
+	origin, err := url.Parse(values[0])
+	if err != nil || origin.Host == "" {
+		return false
+	}
+
+	scheme := strings.ToLower(origin.Scheme)
+	host := strings.ToLower(origin.Hostname())
+	port := portOf(scheme, origin.Port())
+
+	if p.public && samePublic(scheme, host, port, public) {
+		return true
+	}
+
+	if p.sameHost && sameHost(host, port, r) {
+		return true
+	}
+
+	for _, rule := range p.rules {
+		if rule.match(scheme, host, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match returns true if the origin parts match the rule.
+func (r originRule) match(scheme string, host string, port string) bool {
+	if r.scheme != "" && r.scheme != scheme {
+		return false
+	}
+
+	if r.port != "" && r.port != port {
+		return false
+	}
+
+	switch {
+	case r.host == "":
+		return true
+	case r.subdomains:
+		return strings.HasSuffix(host, "."+r.host)
+	default:
+		return host == r.host
+	}
+}
+
+// parseOriginRule parses an address pattern as `[scheme://]host[:port]`.
+func parseOriginRule(pattern string) (originRule, error) {
+	rule := originRule{}
+	rest := strings.ToLower(pattern)
+
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rule.scheme = rest[:i]
+		rest = rest[i+3:]
+		if rule.scheme == "" {
+			return rule, fmt.Errorf("invalid origin pattern '%s': scheme is empty", pattern)
+		}
+	}
+
+	rest = strings.TrimSuffix(rest, "/")
+	if strings.ContainsAny(rest, "/?#") {
+		return rule, fmt.Errorf("invalid origin pattern '%s': it cannot have a path", pattern)
+	}
+
+	host, port, err := net.SplitHostPort(rest)
+	if err != nil {
+		// without port
+		host, port = strings.Trim(rest, "[]"), ""
+	}
+
+	if port == "*" {
+		port = ""
+	}
+	if port != "" && strings.Trim(port, "0123456789") != "" {
+		return rule, fmt.Errorf("invalid origin pattern '%s': wrong port", pattern)
+	}
+	rule.port = port
+
+	switch {
+	case host == "*":
+	case strings.HasPrefix(host, "*."):
+		rule.subdomains = true
+		rule.host = strings.TrimPrefix(host, "*.")
+	default:
+		rule.host = host
+	}
+
+	if host == "" || strings.Contains(rule.host, "*") {
+		return rule, fmt.Errorf("invalid origin pattern '%s': wrong host", pattern)
+	}
+
+	return rule, nil
+}
+
+// samePublic returns true if the origin scheme, host and port are the ones of the public address.
+func samePublic(scheme string, host string, port string, public *url.URL) bool {
+	if public == nil {
+		return false
+	}
+
+	publicScheme := strings.ToLower(public.Scheme)
+
+	return scheme == publicScheme &&
+		strings.EqualFold(host, public.Hostname()) &&
+		port == portOf(publicScheme, public.Port())
+}
+
+// sameHost returns true if the origin host and port are the address used in the request to reach the server.
+//
+// If the request doesn't have the port, it could be received through a proxy that terminates TLS,
+// so the default ports of both schemes are accepted.
+func sameHost(host string, port string, r *http.Request) bool {
+	requestHost, requestPort, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		requestHost, requestPort = strings.Trim(r.Host, "[]"), ""
+	}
+
+	if !strings.EqualFold(host, requestHost) {
+		return false
+	}
+
+	if requestPort == "" {
+		return port == "80" || port == "443"
+	}
+
+	return port == requestPort
+}
+
+// portOf returns the port passed, or the default port of the scheme if it is empty.
+func portOf(scheme string, port string) string {
+	if port != "" {
+		return port
+	}
+
+	switch scheme {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+
+	return ""
+}
@@ -0,0 +1,109 @@
+package websocketconnections
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestNewOriginPolicy(t *testing.T) {
+	cases := map[string][]string{
+		"without patterns": nil,
+		"empty scheme":     {"://localhost"},
+		"with path":        {"http://localhost/page"},
+		"wrong port":       {"localhost:http"},
+		"empty host":       {"http://"},
+		"wildcard inside":  {"dev.*.example.com"},
+	}
+
+	for n, patterns := range cases {
+		t.Run(n, func(t *testing.T) {
+			_, err := NewOriginPolicy(patterns...)
+			if err == nil {
+				t.Errorf("expected an error, got error nil")
+			}
+		})
+	}
+}
+
+func TestOriginPolicyAllow(t *testing.T) {
+	cases := map[string]struct {
+		patterns []string
+		origin   string
+		host     string
+		expected bool
+	}{
+		"default localhost":        {DefaultOrigins, "http://localhost:8080", "proxy:80", true},
+		"default other host":       {DefaultOrigins, "http://evil.com", "localhost:8080", false},
+		"default localhost prefix": {DefaultOrigins, "http://localhost.evil.com", "localhost:8080", false},
+		"default without origin":   {DefaultOrigins, "", "localhost:8080", false},
+		"same host":                {[]string{SameHost}, "http://devbox:8080", "devbox:8080", true},
+		"same host other port":     {[]string{SameHost}, "http://devbox:9090", "devbox:8080", false},
+		"same host other host":     {[]string{SameHost}, "http://evil.com:8080", "devbox:8080", false},
+		"same host default port":   {[]string{SameHost}, "http://devbox", "devbox", true},
+		"same host https":          {[]string{SameHost}, "https://devbox", "devbox:443", true},
+		"same host behind proxy":   {[]string{SameHost}, "https://devbox.example.com", "devbox.example.com", true},
+		"same host ipv6":           {[]string{SameHost}, "http://[::1]:8080", "[::1]:8080", true},
+		"public":                   {[]string{Public}, "https://docs.example.com", "localhost:8080", true},
+		"public explicit port":     {[]string{Public}, "https://docs.example.com:443", "localhost:8080", true},
+		"public other scheme":      {[]string{Public}, "http://docs.example.com", "localhost:8080", false},
+		"public other port":        {[]string{Public}, "https://docs.example.com:8443", "localhost:8080", false},
+		"public other host":        {[]string{Public}, "https://evil.com", "docs.example.com", false},
+		"public not request host":  {[]string{Public}, "http://devbox:8080", "devbox:8080", false},
+		"default public":           {DefaultOrigins, "https://docs.example.com", "proxy:80", true},
+		"allow all":                {[]string{AllowAll}, "http://evil.com", "localhost", true},
+		"allow all without origin": {[]string{AllowAll}, "", "localhost", true},
+		"ip":                       {[]string{"127.0.0.1"}, "http://127.0.0.1:8080", "localhost", true},
+		"scheme":                   {[]string{"https://localhost"}, "http://localhost", "localhost", false},
+		"port":                     {[]string{"localhost:8080"}, "https://localhost:8080", "localhost", true},
+		"any port":                 {[]string{"http://localhost:*"}, "http://localhost:3000", "localhost", true},
+		"other port":               {[]string{"localhost:8080"}, "http://localhost:3000", "localhost", false},
+		"subdomain":                {[]string{"https://*.example.com"}, "https://docs.dev.example.com", "localhost", true},
+		"subdomain not parent":     {[]string{"https://*.example.com"}, "https://example.com", "localhost", false},
+		"subdomain suffix":         {[]string{"*.example.com"}, "https://badexample.com", "localhost", false},
+		"any host":                 {[]string{"https://*"}, "https://any.where", "localhost", true},
+		"case":                     {[]string{"HTTP://LocalHost"}, "http://localhost", "localhost", true},
+		"some pattern":             {[]string{"a.com", "b.com"}, "http://b.com", "localhost", true},
+	}
+
+	// the public address of the server, as it is configured in the reverse proxy
+	public, err := url.Parse("https://docs.example.com")
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			policy, err := NewOriginPolicy(tc.patterns...)
+			if err != nil {
+				t.Fatalf("expected error nil, got '%v'", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			r.Host = tc.host
+			if tc.origin != "" {
+				r.Header.Set("Origin", tc.origin)
+			}
+
+			if policy.Allow(r, public) != tc.expected {
+				t.Errorf("expected %v for origin '%s' with the policy [%s], got %v", tc.expected, tc.origin, policy, !tc.expected)
+			}
+		})
+	}
+}
+
+func TestOriginPolicyAllowWithoutPublic(t *testing.T) {
+	policy, err := NewOriginPolicy(Public)
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Host = "devbox:8080"
+	r.Header.Set("Origin", "http://devbox:8080")
+
+	if policy.Allow(r, nil) {
+		t.Errorf("expected rejected without public address, got allowed")
+	}
+}
@@ -2,16 +2,25 @@
 package websocketconnections
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/gorilla/websocket"
 )
 
+// queueSize is the number of messages that can wait to be written to a client.
+// If a client is so slow that the queue is full, it is disconnected, so it never blocks the messages to other clients.
+const queueSize = 16
+
 // Connection models a connection to the client toghether a websocket.
 //
 // It allows upgrade a request recived to initilize a websocket connection. Manage the connection lifecicle.
@@ -21,9 +30,32 @@ type Connection struct {
 	request    *http.Request
 	ws         websocket.Upgrader
 	connection *websocket.Conn
-	stop       chan bool
-	reload     chan bool
-	fail       chan error
+	messages   chan Message
+
+	// page is the path of the page that opened the connection, reported by the client with the `page` query parameter.
+	page string
+
+	// pingInterval is the time between the pings sent to the client.
+	pingInterval time.Duration
+
+	// pongWait is the maximum time to wait for any message or pong of the client before considering it lost.
+	pongWait time.Duration
+
+	// writeWait is the maximum time to write a message to the client before considering it lost.
+	writeWait time.Duration
+
+	// origins decides if the origin of the request can open the connection.
+	origins *OriginPolicy
+
+	// public is the public address of the server, matched by the [websocketconnections.Public] origin pattern.
+	public *url.URL
+
+	// started is true since the connection begins to listen until it is stopped.
+	started atomic.Bool
+
+	// done is closed when the connection is stopped.
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
 // UUID returns the uuid assiged to websocket connection.
@@ -40,55 +72,122 @@ func (c *Connection) Open() error {
 	}
 
 	c.connection = connection
+	c.page = c.request.URL.Query().Get("page")
+
+	// each pong extends the deadline, so the read fails if the client stops answering
+	c.connection.SetReadDeadline(time.Now().Add(c.pongWait))
+	c.connection.SetPongHandler(func(string) error {
+		return c.connection.SetReadDeadline(time.Now().Add(c.pongWait))
+	})
 
 	return nil
 }
 
+// Page returns the path of the page that opened the connection, or empty if the client didn't report it.
+func (c *Connection) Page() string {
+	return c.page
+}
+
+// Viewing returns true if the page of the connection is under some of the path prefixes passed.
+//
+// See [websocketconnections.MatchPage] to know how the prefixes are matched.
+func (c *Connection) Viewing(prefixes ...string) bool {
+	return MatchPage(c.page, prefixes...)
+}
+
+// MatchPage returns true if the page path is under some of the path prefixes passed.
+//
+// The prefixes are matched by complete segments, so `/example.com/a` matches the pages `/example.com/a`,
+// `/example.com/a/pkg` and `/example.com/a@v1.0.0/pkg`, but not `/example.com/ab`.
+// If there aren't prefixes, or the page is unknown, it is considered viewing all pages.
+func MatchPage(page string, prefixes ...string) bool {
+	if len(prefixes) == 0 || page == "" {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		prefix = "/" + strings.Trim(prefix, "/")
+		if prefix == "/" || page == prefix ||
+			strings.HasPrefix(page, prefix+"/") || strings.HasPrefix(page, prefix+"@") {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Start executes the go routines to begin to listen the messages and watch the status connection.
+//
+// This method is blocked until the connection is stopped, by the client or calling [Connection.Stop].
 func (c *Connection) Start() error {
 
-	c.stop = make(chan bool)
-	c.reload = make(chan bool)
-	c.fail = make(chan error)
+	c.started.Store(true)
 
 	go c.alive()
 	go c.watch()
 
+	<-c.done
+
+	return nil
+}
+
+// Send enqueues a message to be written to the client, even if the connection is not started yet.
+//
+// This method is never blocked. Returns an error if the connection is stopped,
+// or if the queue of the client is full, in which case the connection is stopped because the client is too slow.
+func (c *Connection) Send(message Message) error {
 	select {
-	case <-c.stop:
-		{
-			c.stop = nil
-			c.reload = nil
-			c.fail = nil
+	case <-c.done:
+		return fmt.Errorf("(%s) failed to send %s message, so the connection is stopped", c.UUID(), message.Type)
+	default:
+	}
 
-			return nil
-		}
-	case err := <-c.fail:
-		{
-			return fmt.Errorf("(%s) something was bad while the connection was active: %v", c.UUID(), err)
-		}
+	select {
+	case c.messages <- message:
+		return nil
+	default:
+		c.Stop()
+		return fmt.Errorf("(%s) failed to send %s message, so the client is too slow and it is disconnected", c.UUID(), message.Type)
 	}
 }
 
 // Reload enables the sending of the reload message to the client.
 func (c *Connection) Reload() error {
-	if c.reload == nil {
-		return fmt.Errorf("(%s) failed to reload, so the connection is not started", c.UUID())
+	message, err := NewMessage(Reload, "")
+	if err != nil {
+		return err
 	}
-	c.reload <- true
-	return nil
+	return c.Send(message)
 }
 
-// Stop terminates with the watching and listening of the connection.
+// Stop terminates with the watching and listening of the connection. It can be called many times.
 func (c *Connection) Stop() error {
-	if c.stop == nil {
+	if !c.started.Load() {
 		return fmt.Errorf("(%s) failed to stop, so the connection is not started", c.UUID())
 	}
 
-	c.stop <- true
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
 	return nil
 }
 
+// Shutdown sends a close frame to the client, to notify it that the server is going away,
+// and stops the connection.
+func (c *Connection) Shutdown() error {
+	if !c.started.Load() {
+		return fmt.Errorf("(%s) failed to shutdown, so the connection is not started", c.UUID())
+	}
+
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	err := c.connection.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		log.Printf("(%s) failed to send close frame: %v", c.UUID(), err)
+	}
+
+	return c.Stop()
+}
+
 // Close disconnects and closes the websocket connection.
 func (c *Connection) Close() error {
 	err := c.connection.Close()
@@ -100,29 +199,58 @@ func (c *Connection) Close() error {
 
 // alive waits to recive any message allows us know if the connection is lossed or maintain alive.
 //
-// When an error is detected, it sends a stop signal to terminate with the watching and listening of the connection.
+// When an error is detected, as the pong deadline reached, it stops the connection
+// to terminate with the watching and listening of the connection.
 func (c *Connection) alive() {
 	for {
 		_, _, err := c.connection.ReadMessage()
 		if err != nil {
-			c.stop <- true
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("(%s) connection lost: %v", c.UUID(), err)
+			}
+			c.Stop()
+			return
 		}
+
+		c.connection.SetReadDeadline(time.Now().Add(c.pongWait))
 	}
 }
 
-// watch sends the reload signal as text message to the client when it needed.
+// watch writes the messages as JSON text messages to the client when it needed,
+// and pings the client periodically to detect if it is lost.
 func (c *Connection) watch() {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-c.reload:
+		case message := <-c.messages:
 			{
-				err := c.connection.WriteMessage(1, []byte("reload"))
+				data, err := message.Encode()
+				if err != nil {
+					log.Printf("(%s) failed to encode %s message: %s", c.UUID(), message.Type, err)
+					break
+				}
+
+				// a client that doesn't read its messages must not block the connection forever
+				c.connection.SetWriteDeadline(time.Now().Add(c.writeWait))
+
+				err = c.connection.WriteMessage(websocket.TextMessage, data)
 				if err != nil {
-					log.Printf("(%s) failed to send reload signal: %s", c.UUID(), err)
+					log.Printf("(%s) failed to send %s message: %s", c.UUID(), message.Type, err)
+					c.Stop()
 					break
 				}
 			}
-		case <-c.stop:
+		case <-ticker.C:
+			{
+				err := c.connection.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.pingInterval))
+				if err != nil {
+					log.Printf("(%s) failed to ping: %s", c.UUID(), err)
+					c.Stop()
+				}
+			}
+		case <-c.done:
 			{
 				log.Printf("(%s) stoping watcher", c.UUID())
 				return
@@ -138,6 +266,21 @@ type Configurer interface {
 
 	// Request allows set the request instance received by the client.
 	Request(request *http.Request) error
+
+	// PingInterval allows set the time between the pings sent to the client. It must be less than the pong wait.
+	PingInterval(interval time.Duration) error
+
+	// PongWait allows set the maximum time to wait for the pong of the client before closing the connection.
+	PongWait(wait time.Duration) error
+
+	// WriteWait allows set the maximum time to write a message to the client before closing the connection.
+	WriteWait(wait time.Duration) error
+
+	// Origins allows set the policy that decides which origins can open the connection.
+	Origins(policy *OriginPolicy) error
+
+	// Public allows set the public address of the server, as the pages reach it, matched by the [websocketconnections.Public] origin pattern.
+	Public(address string) error
 }
 
 // configurerPool implements [websocketconnections.Configurer] interface.
@@ -167,22 +310,110 @@ func (cp *configurerPool) Request(request *http.Request) error {
 	return nil
 }
 
+// PingInterval implements [Configurer.PingInterval] method.
+func (cp *configurerPool) PingInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("ping interval must be greater than zero")
+	}
+
+	cp.pool = append(cp.pool, func(c *Connection) error {
+		c.pingInterval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// PongWait implements [Configurer.PongWait] method.
+func (cp *configurerPool) PongWait(wait time.Duration) error {
+
+	if wait <= 0 {
+		return fmt.Errorf("pong wait must be greater than zero")
+	}
+
+	cp.pool = append(cp.pool, func(c *Connection) error {
+		c.pongWait = wait
+		return nil
+	})
+
+	return nil
+}
+
+// WriteWait implements [Configurer.WriteWait] method.
+func (cp *configurerPool) WriteWait(wait time.Duration) error {
+
+	if wait <= 0 {
+		return fmt.Errorf("write wait must be greater than zero")
+	}
+
+	cp.pool = append(cp.pool, func(c *Connection) error {
+		c.writeWait = wait
+		return nil
+	})
+
+	return nil
+}
+
+// Origins implements [Configurer.Origins] method.
+func (cp *configurerPool) Origins(policy *OriginPolicy) error {
+
+	if policy == nil {
+		return fmt.Errorf("origin policy cannot be nil")
+	}
+
+	cp.pool = append(cp.pool, func(c *Connection) error {
+		c.origins = policy
+		return nil
+	})
+
+	return nil
+}
+
+// Public implements [Configurer.Public] method.
+func (cp *configurerPool) Public(address string) error {
+
+	public, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse the public address: %v", err)
+	}
+
+	if public.Scheme == "" || public.Host == "" {
+		return fmt.Errorf("public address '%s' must have scheme and host", address)
+	}
+
+	cp.pool = append(cp.pool, func(c *Connection) error {
+		c.public = public
+		return nil
+	})
+
+	return nil
+}
+
 // New returns a [websocketconnections.Connection] instance with request and response instanced configured.
+//
+// By default, the client is pinged each 30 seconds and it is considered lost if it doesn't answer in 60 seconds
+// or doesn't take a message in 10 seconds, and the origins allowed are [websocketconnections.DefaultOrigins].
 func New(options ...func(Configurer) error) (*Connection, error) {
 
 	configuration := &configurerPool{}
 	conn := &Connection{
-		uuid: uuid.New(),
+		uuid:         uuid.New(),
+		messages:     make(chan Message, queueSize),
+		done:         make(chan struct{}),
+		pingInterval: 30 * time.Second,
+		pongWait:     60 * time.Second,
+		writeWait:    10 * time.Second,
 	}
 
 	conn.ws = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
-			origin := r.Header.Values("Origin")
-			if len(origin) != 1 {
-				return false
+			if conn.origins.Allow(r, conn.public) {
+				return true
 			}
 
-			return strings.HasPrefix(origin[0], "http://localhost")
+			log.Printf("(%s) connection rejected: origin '%s' is not allowed by the policy [%s]", conn.UUID(), r.Header.Get("Origin"), conn.origins)
+			return false
 		},
 	}
 
@@ -208,5 +439,17 @@ func New(options ...func(Configurer) error) (*Connection, error) {
 		return nil, fmt.Errorf("(%s) response is required", conn.UUID())
 	}
 
+	if conn.origins == nil {
+		policy, err := NewOriginPolicy(DefaultOrigins...)
+		if err != nil {
+			return nil, fmt.Errorf("(%s) failed to load the default origin policy: %v", conn.UUID(), err)
+		}
+		conn.origins = policy
+	}
+
+	if conn.pingInterval >= conn.pongWait {
+		return nil, fmt.Errorf("(%s) ping interval must be less than pong wait", conn.UUID())
+	}
+
 	return conn, nil
 }
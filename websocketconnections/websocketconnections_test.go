@@ -3,6 +3,7 @@ package websocketconnections
 import (
 	"net/http"
 	"testing"
+	"time"
 )
 
 type responseWriterFacke struct {
@@ -70,4 +71,134 @@ func TestNew(t *testing.T) {
 			t.Errorf("expected error nil, got '%v'", err)
 		}
 	})
+
+	t.Run("ping interval wrong", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			return c.PingInterval(0)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("ping interval greater than pong wait", func(t *testing.T) {
+		_, err := New(func(c Configurer) error {
+			err := c.Request(&http.Request{})
+			if err != nil {
+				return err
+			}
+
+			err = c.ResponseWriter(&responseWriterFacke{})
+			if err != nil {
+				return err
+			}
+
+			err = c.PingInterval(time.Minute)
+			if err != nil {
+				return err
+			}
+
+			return c.PongWait(time.Second)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+func TestNewMessage(t *testing.T) {
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := NewMessage("refreshcss", "")
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	cases := map[string]struct {
+		messageType MessageType
+		text        string
+		expected    string
+	}{
+		"reload": {Reload, "", `{"version":1,"type":"reload"}`},
+		"css":    {CSS, "", `{"version":1,"type":"css"}`},
+		"error":  {Error, "build failed", `{"version":1,"type":"error","text":"build failed"}`},
+		"status": {Status, "restarting", `{"version":1,"type":"status","text":"restarting"}`},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			message, err := NewMessage(tc.messageType, tc.text)
+			if err != nil {
+				t.Fatalf("expected error nil, got '%v'", err)
+			}
+
+			data, err := message.Encode()
+			if err != nil {
+				t.Fatalf("expected error nil, got '%v'", err)
+			}
+
+			if string(data) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, data)
+			}
+		})
+	}
+}
+
+func TestViewing(t *testing.T) {
+	cases := map[string]struct {
+		page     string
+		prefixes []string
+		expected bool
+	}{
+		"without prefixes":  {"/example.com/a", nil, true},
+		"without page":      {"", []string{"/example.com/a"}, true},
+		"same page":         {"/example.com/a", []string{"/example.com/a"}, true},
+		"package":           {"/example.com/a/pkg", []string{"example.com/a"}, true},
+		"version":           {"/example.com/a@v1.0.0/pkg", []string{"/example.com/a/"}, true},
+		"other module":      {"/example.com/ab", []string{"/example.com/a"}, false},
+		"some prefix":       {"/example.com/b", []string{"/example.com/a", "/example.com/b"}, true},
+		"root prefix":       {"/search", []string{"/"}, true},
+		"parent not viewed": {"/example.com", []string{"/example.com/a"}, false},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			c := &Connection{page: tc.page}
+			if c.Viewing(tc.prefixes...) != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, !tc.expected)
+			}
+		})
+	}
+}
+
+func TestSendQueueFull(t *testing.T) {
+	conn, err := New(func(c Configurer) error {
+		err := c.Request(&http.Request{})
+		if err != nil {
+			return err
+		}
+		return c.ResponseWriter(&responseWriterFacke{})
+	})
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	message, err := NewMessage(Reload, "")
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	// nobody takes the messages, so they wait in the queue until it is full
+	for i := 0; i < queueSize; i++ {
+		err := conn.Send(message)
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+	}
+
+	err = conn.Send(message)
+	if err == nil {
+		t.Errorf("expected an error, got error nil")
+	}
 }
@@ -0,0 +1,83 @@
+package websocketserver
+
+import (
+	"sync"
+
+	"github.com/mauroalderete/pkgsite-local-live/websocketconnections"
+)
+
+// Client defines a connection that receives the messages of the server,
+// as a [websocketconnections.Connection] or its fallback [sseconnections.Connection].
+type Client interface {
+
+	// UUID returns the identifier of the connection.
+	UUID() string
+
+	// Viewing returns true if the page of the client is under some of the path prefixes passed.
+	Viewing(prefixes ...string) bool
+
+	// Send enqueues a message to be written to the client.
+	Send(message websocketconnections.Message) error
+
+	// Stop terminates the connection.
+	Stop() error
+
+	// Shutdown notifies the client that the server is going away and terminates the connection.
+	Shutdown() error
+}
+
+// registry stores the connections establishment indexed by their uuid.
+//
+// It is safe to use from many goroutines, as the handlers of each connection
+// and the broadcasting of the reload signal.
+type registry struct {
+	mutex       sync.RWMutex
+	connections map[string]Client
+}
+
+// newRegistry returns an empty [websocketserver.registry].
+func newRegistry() *registry {
+	return &registry{
+		connections: make(map[string]Client),
+	}
+}
+
+// Add stores a connection. If there is other connection with the same uuid, it is replaced.
+func (r *registry) Add(conn Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.connections[conn.UUID()] = conn
+}
+
+// Remove deletes the connection with the uuid passed. It does nothing if the connection isn't stored.
+func (r *registry) Remove(uuid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.connections, uuid)
+}
+
+// Snapshot returns a copy of the connections stored at the moment of the call.
+//
+// The copy can be iterated without locking the registry, so the connections can be added
+// or removed while the signals are sent.
+func (r *registry) Snapshot() []Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	snapshot := make([]Client, 0, len(r.connections))
+	for _, conn := range r.connections {
+		snapshot = append(snapshot, conn)
+	}
+
+	return snapshot
+}
+
+// Count returns the number of connections stored.
+func (r *registry) Count() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.connections)
+}
@@ -0,0 +1,85 @@
+package websocketserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mauroalderete/pkgsite-local-live/websocketconnections"
+)
+
+// newConnection returns a connection not opened, enough to be stored by the registry.
+func newConnection(t *testing.T) *websocketconnections.Connection {
+	conn, err := websocketconnections.New(func(c websocketconnections.Configurer) error {
+		err := c.Request(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			return err
+		}
+		return c.ResponseWriter(httptest.NewRecorder())
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the connection: %v", err)
+	}
+	return conn
+}
+
+func TestRegistry(t *testing.T) {
+
+	t.Run("operations", func(t *testing.T) {
+		r := newRegistry()
+		a := newConnection(t)
+		b := newConnection(t)
+
+		r.Add(a)
+		r.Add(b)
+		r.Add(a)
+		if r.Count() != 2 {
+			t.Errorf("expected 2 connections, got %d", r.Count())
+		}
+
+		snapshot := r.Snapshot()
+		r.Remove(a.UUID())
+		r.Remove("unknown")
+		if len(snapshot) != 2 {
+			t.Errorf("expected the snapshot keeps 2 connections, got %d", len(snapshot))
+		}
+
+		if r.Count() != 1 || r.Snapshot()[0] != Client(b) {
+			t.Errorf("expected only the connection %s, got %v", b.UUID(), r.Snapshot())
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		r := newRegistry()
+		wg := sync.WaitGroup{}
+
+		for i := 0; i < 50; i++ {
+			conn := newConnection(t)
+
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					r.Add(conn)
+					r.Remove(conn.UUID())
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					for _, c := range r.Snapshot() {
+						c.UUID()
+					}
+					r.Count()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if r.Count() != 0 {
+			t.Errorf("expected the registry empty, got %d connections", r.Count())
+		}
+	})
+}
@@ -2,20 +2,33 @@
 package websocketserver
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	neturl "net/url"
+	"time"
 
+	"github.com/mauroalderete/pkgsite-local-live/sseconnections"
 	"github.com/mauroalderete/pkgsite-local-live/websocketconnections"
 )
 
 // WebsocketServer stores a server instance and the connections establishment
+//
+// Optionally, stores a healthcheck address that must respond successfully before sending the reload signal.
 type WebsocketServer struct {
-	endpoint    *neturl.URL
-	server      *http.ServeMux
-	connections map[string]*websocketconnections.Connection
+	endpoint            *neturl.URL
+	server              *http.ServeMux
+	connections         *registry
+	healthcheck         *neturl.URL
+	healthcheckTimeout  time.Duration
+	healthcheckInterval time.Duration
+	healthcheckRequest  time.Duration
+	pingInterval        time.Duration
+	pongWait            time.Duration
+	origins             *websocketconnections.OriginPolicy
+	public              string
 }
 
 // responseError writes an error message and print it although standar logger.
@@ -52,6 +65,32 @@ func (rw *WebsocketServer) WebsocketHandler(w http.ResponseWriter, r *http.Reque
 			return fmt.Errorf("failed to config response: %v", err)
 		}
 
+		err = c.PingInterval(rw.pingInterval)
+		if err != nil {
+			return fmt.Errorf("failed to config ping interval: %v", err)
+		}
+
+		err = c.PongWait(rw.pongWait)
+		if err != nil {
+			return fmt.Errorf("failed to config pong wait: %v", err)
+		}
+
+		if rw.public != "" {
+			err = c.Public(rw.public)
+			if err != nil {
+				return fmt.Errorf("failed to config public address: %v", err)
+			}
+		}
+
+		if rw.origins == nil {
+			return nil
+		}
+
+		err = c.Origins(rw.origins)
+		if err != nil {
+			return fmt.Errorf("failed to config origin policy: %v", err)
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -66,8 +105,13 @@ func (rw *WebsocketServer) WebsocketHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Stores the websocket connection to send reload signal later
-	rw.connections[connection.UUID()] = connection
+	// Closes the connection if it isn't yet.
+	defer connection.Close()
+
+	// Stores the websocket connection to send reload signal later,
+	// and removes it from the list when it is terminated
+	rw.connections.Add(connection)
+	defer rw.connections.Remove(connection.UUID())
 
 	// Runs the websocket connection and wait to ends.
 	err = connection.Start()
@@ -75,22 +119,197 @@ func (rw *WebsocketServer) WebsocketHandler(w http.ResponseWriter, r *http.Reque
 		rw.responseError(w, fmt.Errorf("failed to start a connection: %v", err))
 		return
 	}
+}
 
-	// Removes the connection terminated from the list
-	delete(rw.connections, connection.UUID())
+// EventsHandler handles a new Server-Sent Events connection, the fallback of the websocket connections.
+//
+// The connection is stored in the same list of the websocket connections, so it receives the same messages.
+// This method is blocked until the client closes the request or the server is stopped.
+func (rw *WebsocketServer) EventsHandler(w http.ResponseWriter, r *http.Request) {
 
-	// Closes the connection if it isn't yet.
-	defer connection.Close()
+	// Creates a new event stream connection
+	connection, err := sseconnections.New(func(c sseconnections.Configurer) error {
+		err := c.Request(r)
+		if err != nil {
+			return fmt.Errorf("failed to config request: %v", err)
+		}
+
+		err = c.ResponseWriter(w)
+		if err != nil {
+			return fmt.Errorf("failed to config response: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rw.responseError(w, fmt.Errorf("failed to create a connection: %v", err))
+		return
+	}
+
+	// Opens the event stream
+	err = connection.Open()
+	if err != nil {
+		rw.responseError(w, fmt.Errorf("failed to create a connection: %v", err))
+		return
+	}
+
+	// Stores the connection to send reload signal later,
+	// and removes it from the list when it is terminated
+	rw.connections.Add(connection)
+	defer rw.connections.Remove(connection.UUID())
+
+	// Writes the events until the connection ends.
+	err = connection.Start()
+	if err != nil {
+		log.Printf("failed to start a connection: %v", err)
+	}
 }
 
 // ReloadHandler sends reload signal to all connections stored.
 //
-// The arguments aren't used, but it is maintain to compatibility with [http.Handler] interface.
+// The query parameters `type` and `text` allow send any message of the protocol, as `?type=css`
+// to refresh only the stylesheets or `?type=status&text=building` to notify a status.
+// Without parameters, the reload message is sent.
+//
+// The query parameters `module` and `prefix` allow send the message only to the connections
+// viewing the pages of a module, as `?module=example.com/a`, or under an URL path, as `?prefix=/example.com/a/pkg`.
+// Both can be repeated.
+//
+// If the type is unknown, responds with the status 400 Bad Request,
+// and if the healthcheck fails, responds with the status 503 Service Unavailable.
 func (rw *WebsocketServer) ReloadHandler(w http.ResponseWriter, r *http.Request) {
-	for _, conn := range rw.connections {
-		log.Printf("send reload signal to %s connection\n", conn.UUID())
-		conn.Reload()
+	query := r.URL.Query()
+
+	t := websocketconnections.Reload
+	if v := query.Get("type"); v != "" {
+		t = websocketconnections.MessageType(v)
+	}
+
+	if !t.Valid() {
+		w.WriteHeader(http.StatusBadRequest)
+		rw.responseError(w, fmt.Errorf("unknown message type '%s'", t))
+		return
+	}
+
+	prefixes := query["prefix"]
+	for _, module := range query["module"] {
+		prefixes = append(prefixes, "/"+module)
+	}
+
+	err := rw.Notify(t, query.Get("text"), prefixes...)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		rw.responseError(w, err)
+	}
+}
+
+// Reload sends reload signal to the connections viewing the pages under the path prefixes passed,
+// or to all connections stored if there aren't prefixes.
+//
+// If a healthcheck address is configured, it waits until the address responds successfully.
+// Returns an error without sending the signal if the healthcheck timeout is reached.
+func (rw *WebsocketServer) Reload(prefixes ...string) error {
+	return rw.Notify(websocketconnections.Reload, "", prefixes...)
+}
+
+// Notify sends a message of the type passed to the connections viewing the pages under the path prefixes passed,
+// or to all connections stored if there aren't prefixes.
+//
+// The reload and css messages make the clients request the origin again, so if a healthcheck
+// address is configured, it waits until the address responds successfully.
+// Returns an error without sending the message if the healthcheck timeout is reached.
+func (rw *WebsocketServer) Notify(t websocketconnections.MessageType, text string, prefixes ...string) error {
+	message, err := websocketconnections.NewMessage(t, text)
+	if err != nil {
+		return err
+	}
+
+	if rw.healthcheck != nil && (t == websocketconnections.Reload || t == websocketconnections.CSS) {
+		err := rw.waitHealthy()
+		if err != nil {
+			return fmt.Errorf("%s message not sent: %v", t, err)
+		}
+	}
+
+	rw.Broadcast(message, prefixes...)
+
+	return nil
+}
+
+// Broadcast sends a message, without any check, to the connections viewing the pages under the path prefixes passed,
+// or to all connections stored if there aren't prefixes.
+func (rw *WebsocketServer) Broadcast(message websocketconnections.Message, prefixes ...string) {
+	for _, conn := range rw.connections.Snapshot() {
+		if !conn.Viewing(prefixes...) {
+			continue
+		}
+
+		log.Printf("send %s message to %s connection\n", message.Type, conn.UUID())
+
+		err := conn.Send(message)
+		if err != nil {
+			log.Printf("failed to send the message: %v", err)
+		}
+	}
+}
+
+// waitHealthy polls the healthcheck address until it responds with a status 2xx or 3xx.
+//
+// Each query waits its response up to the healthcheck request timeout, or the time remaining if it is lower,
+// so the slow pages of an origin just restarted are considered healthy.
+// Returns an error if the healthcheck timeout is reached before.
+func (rw *WebsocketServer) waitHealthy() error {
+	client := &http.Client{
+		// the redirections are considered healthy responses
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	deadline := time.Now().Add(rw.healthcheckTimeout)
+
+	for {
+		err := rw.query(client, deadline)
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().Add(rw.healthcheckInterval).After(deadline) {
+			return fmt.Errorf("%s is not healthy after %s: %v", rw.healthcheck, rw.healthcheckTimeout, err)
+		}
+
+		time.Sleep(rw.healthcheckInterval)
+	}
+}
+
+// query requests the healthcheck address once, and returns an error if it doesn't respond with a status 2xx or 3xx
+// before the healthcheck request timeout or the deadline passed.
+func (rw *WebsocketServer) query(client *http.Client, deadline time.Time) error {
+	timeout := rw.healthcheckRequest
+	if remaining := time.Until(deadline); remaining < timeout {
+		timeout = remaining
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rw.healthcheck.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %s", response.Status)
 	}
+
+	return nil
 }
 
 // Run starts to listen and serve the current server on address configured.
@@ -105,18 +324,62 @@ func (rw *WebsocketServer) Run() error {
 	return nil
 }
 
+// Count returns the number of connections establishment.
+func (rw *WebsocketServer) Count() int {
+	return rw.connections.Count()
+}
+
 // Stop allows stop all connections.
 func (rw *WebsocketServer) Stop() {
-	for _, conn := range rw.connections {
+	for _, conn := range rw.connections.Snapshot() {
 		conn.Stop()
 	}
 }
 
+// Shutdown sends a close frame to all connections and stops them,
+// so the clients know that the server is going away.
+func (rw *WebsocketServer) Shutdown() {
+	for _, conn := range rw.connections.Snapshot() {
+		err := conn.Shutdown()
+		if err != nil {
+			log.Printf("failed to shutdown the connection: %v", err)
+		}
+	}
+}
+
 // Configurator defines the optionable configurations to instance a new WebsocketServer.
 type Configurator interface {
 
 	// Endpoint allows set the endpoint address of the websocket.
 	Endpoint(url string) error
+
+	// Healthcheck allows set an address that must respond successfully before sending the reload signal.
+	Healthcheck(url string) error
+
+	// HealthcheckTimeout allows set the maximum time to wait for the healthcheck address.
+	HealthcheckTimeout(timeout time.Duration) error
+
+	// HealthcheckInterval allows set the time between each query to the healthcheck address.
+	HealthcheckInterval(interval time.Duration) error
+
+	// HealthcheckRequestTimeout allows set the maximum time to wait the response of each query to the healthcheck address,
+	// as the pages that take long to render. It is limited by the time remaining of the healthcheck timeout.
+	HealthcheckRequestTimeout(timeout time.Duration) error
+
+	// PingInterval allows set the time between the pings sent to each websocket client.
+	PingInterval(interval time.Duration) error
+
+	// PongWait allows set the maximum time to wait for the pong of a websocket client.
+	// The clients that don't answer are closed and removed. It must be greater than the ping interval.
+	PongWait(wait time.Duration) error
+
+	// Origins allows set the patterns of the origins that can open a websocket connection,
+	// as described by [websocketconnections.OriginPolicy].
+	Origins(patterns ...string) error
+
+	// Public allows set the public address of the server, as the pages reach it,
+	// matched by the [websocketconnections.Public] origin pattern.
+	Public(address string) error
 }
 
 // configurer implements [websocketserver.Configurator]. Maintains a pool with configurations to execute.
@@ -140,9 +403,139 @@ func (c *configurer) Endpoint(url string) error {
 	return nil
 }
 
+// Healthcheck implements [websocketserver.Configurator.Healthcheck] method.
+func (c *configurer) Healthcheck(url string) error {
+
+	healthcheck, err := neturl.Parse(url)
+	if err != nil {
+		return fmt.Errorf("failed to parse healthcheck url: %v", err)
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.healthcheck = healthcheck
+		return nil
+	})
+
+	return nil
+}
+
+// HealthcheckTimeout implements [websocketserver.Configurator.HealthcheckTimeout] method.
+func (c *configurer) HealthcheckTimeout(timeout time.Duration) error {
+
+	if timeout <= 0 {
+		return fmt.Errorf("healthcheck timeout must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.healthcheckTimeout = timeout
+		return nil
+	})
+
+	return nil
+}
+
+// HealthcheckInterval implements [websocketserver.Configurator.HealthcheckInterval] method.
+func (c *configurer) HealthcheckInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("healthcheck interval must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.healthcheckInterval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// HealthcheckRequestTimeout implements [websocketserver.Configurator.HealthcheckRequestTimeout] method.
+func (c *configurer) HealthcheckRequestTimeout(timeout time.Duration) error {
+
+	if timeout <= 0 {
+		return fmt.Errorf("healthcheck request timeout must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.healthcheckRequest = timeout
+		return nil
+	})
+
+	return nil
+}
+
+// PingInterval implements [websocketserver.Configurator.PingInterval] method.
+func (c *configurer) PingInterval(interval time.Duration) error {
+
+	if interval <= 0 {
+		return fmt.Errorf("ping interval must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.pingInterval = interval
+		return nil
+	})
+
+	return nil
+}
+
+// PongWait implements [websocketserver.Configurator.PongWait] method.
+func (c *configurer) PongWait(wait time.Duration) error {
+
+	if wait <= 0 {
+		return fmt.Errorf("pong wait must be greater than zero")
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.pongWait = wait
+		return nil
+	})
+
+	return nil
+}
+
+// Origins implements [websocketserver.Configurator.Origins] method.
+func (c *configurer) Origins(patterns ...string) error {
+
+	policy, err := websocketconnections.NewOriginPolicy(patterns...)
+	if err != nil {
+		return err
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.origins = policy
+		return nil
+	})
+
+	return nil
+}
+
+// Public implements [websocketserver.Configurator.Public] method.
+func (c *configurer) Public(address string) error {
+
+	public, err := neturl.Parse(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse public address: %v", err)
+	}
+
+	if public.Scheme == "" || public.Host == "" {
+		return fmt.Errorf("public address '%s' must have scheme and host", address)
+	}
+
+	c.pool = append(c.pool, func(rw *WebsocketServer) error {
+		rw.public = address
+		return nil
+	})
+
+	return nil
+}
+
 // New returns a new [websocketserver.WebsocketServer] instance with the endpoint set.
 //
-// Initializes a [http.ServerMux] with the two routes to handle new websocket connections and reload signal.
+// Initializes a [http.ServerMux] with the routes to handle new websocket and event stream connections and reload signal.
+// By default, the healthcheck address is queried each 250 milliseconds during 30 seconds, waiting each response up to 5 seconds,
+// the websocket clients are pinged each 30 seconds and closed if they don't answer in 60 seconds,
+// and the origins allowed are [websocketconnections.DefaultOrigins].
 func New(options ...func(Configurator) error) (*WebsocketServer, error) {
 	configurer := &configurer{}
 
@@ -153,7 +546,13 @@ func New(options ...func(Configurator) error) (*WebsocketServer, error) {
 		}
 	}
 
-	websocket := &WebsocketServer{}
+	websocket := &WebsocketServer{
+		healthcheckTimeout:  30 * time.Second,
+		healthcheckInterval: 250 * time.Millisecond,
+		healthcheckRequest:  5 * time.Second,
+		pingInterval:        30 * time.Second,
+		pongWait:            60 * time.Second,
+	}
 
 	for _, config := range configurer.pool {
 		err := config(websocket)
@@ -166,11 +565,16 @@ func New(options ...func(Configurator) error) (*WebsocketServer, error) {
 		return nil, fmt.Errorf("endpoint is required")
 	}
 
+	if websocket.pingInterval >= websocket.pongWait {
+		return nil, fmt.Errorf("ping interval must be less than pong wait")
+	}
+
 	websocket.server = http.NewServeMux()
 
-	websocket.connections = make(map[string]*websocketconnections.Connection)
+	websocket.connections = newRegistry()
 	websocket.server.HandleFunc("/", websocket.WebsocketHandler)
 	websocket.server.HandleFunc("/reload", websocket.ReloadHandler)
+	websocket.server.HandleFunc("/events", websocket.EventsHandler)
 
 	return websocket, nil
 }
@@ -0,0 +1,636 @@
+package websocketserver
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mauroalderete/pkgsite-local-live/websocketconnections"
+)
+
+func TestNew(t *testing.T) {
+
+	t.Run("without endpoint", func(t *testing.T) {
+		_, err := New(func(c Configurator) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("healthcheck timeout wrong", func(t *testing.T) {
+		_, err := New(func(c Configurator) error {
+			return c.HealthcheckTimeout(0)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("healthcheck interval wrong", func(t *testing.T) {
+		_, err := New(func(c Configurator) error {
+			return c.HealthcheckInterval(-time.Second)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("ping interval greater than pong wait", func(t *testing.T) {
+		_, err := New(func(c Configurator) error {
+			err := c.Endpoint("localhost:8080")
+			if err != nil {
+				return err
+			}
+			return c.PongWait(time.Second)
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		_, err := New(func(c Configurator) error {
+			err := c.Endpoint("localhost:8080")
+			if err != nil {
+				return err
+			}
+			return c.Healthcheck("http://localhost:3000")
+		})
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+		}
+	})
+}
+
+// newHealthchecked returns a websocket server that waits for the address passed.
+func newHealthchecked(t *testing.T, address string) *WebsocketServer {
+	ws, err := New(func(c Configurator) error {
+		err := c.Endpoint("localhost:8080")
+		if err != nil {
+			return err
+		}
+		err = c.Healthcheck(address)
+		if err != nil {
+			return err
+		}
+		err = c.HealthcheckTimeout(time.Second)
+		if err != nil {
+			return err
+		}
+		return c.HealthcheckInterval(10 * time.Millisecond)
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	return ws
+}
+
+func TestReloadHealthcheck(t *testing.T) {
+
+	t.Run("healthy after some queries", func(t *testing.T) {
+		var queries int32
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&queries, 1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer origin.Close()
+
+		ws := newHealthchecked(t, origin.URL)
+
+		err := ws.Reload()
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+		}
+
+		if atomic.LoadInt32(&queries) != 3 {
+			t.Errorf("expected 3 queries, got %d", queries)
+		}
+	})
+
+	t.Run("slower than the interval", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer origin.Close()
+
+		ws := newHealthchecked(t, origin.URL)
+
+		err := ws.Reload()
+		if err != nil {
+			t.Errorf("expected error nil, got '%v'", err)
+		}
+	})
+
+	t.Run("slower than the request timeout", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}))
+		defer origin.Close()
+
+		ws := newHealthchecked(t, origin.URL)
+		ws.healthcheckRequest = 50 * time.Millisecond
+		ws.healthcheckTimeout = 200 * time.Millisecond
+
+		start := time.Now()
+		err := ws.Reload()
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("expected the wait limited by the healthcheck timeout, got %v", elapsed)
+		}
+	})
+
+	t.Run("never healthy", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer origin.Close()
+
+		ws := newHealthchecked(t, origin.URL)
+
+		response := httptest.NewRecorder()
+		ws.ReloadHandler(response, httptest.NewRequest(http.MethodGet, "/reload", nil))
+
+		if response.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, response.Code)
+		}
+	})
+
+	t.Run("origin down", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		origin.Close()
+
+		ws := newHealthchecked(t, origin.URL)
+
+		err := ws.Reload()
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+// connect dials a websocket server served by a test server from the page passed, and waits the connection is stored.
+func connect(t *testing.T, ws *WebsocketServer, page string) *websocket.Conn {
+	server := httptest.NewServer(http.HandlerFunc(ws.WebsocketHandler))
+	t.Cleanup(server.Close)
+
+	header := http.Header{}
+	header.Set("Origin", "http://localhost")
+
+	count := ws.Count()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?page="+neturl.QueryEscape(page), header)
+	if err != nil {
+		t.Fatalf("failed to dial the websocket server: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	deadline := time.Now().Add(time.Second)
+	for ws.Count() == count && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return client
+}
+
+func TestNotify(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer origin.Close()
+
+	// the origin never is healthy, so only the messages that don't reload the page are sent
+	ws := newHealthchecked(t, origin.URL)
+	client := connect(t, ws, "/")
+
+	t.Run("status", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		ws.ReloadHandler(response, httptest.NewRequest(http.MethodGet, "/reload?type=status&text=building", nil))
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, response.Code)
+		}
+
+		message := websocketconnections.Message{}
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		err := client.ReadJSON(&message)
+		if err != nil {
+			t.Fatalf("expected error nil, got '%v'", err)
+		}
+
+		expected := websocketconnections.Message{Version: websocketconnections.ProtocolVersion, Type: websocketconnections.Status, Text: "building"}
+		if message != expected {
+			t.Errorf("expected %+v, got %+v", expected, message)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		ws.ReloadHandler(response, httptest.NewRequest(http.MethodGet, "/reload?type=refreshcss", nil))
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, response.Code)
+		}
+	})
+
+	t.Run("css waits the origin", func(t *testing.T) {
+		err := ws.Notify(websocketconnections.CSS, "")
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}
+
+func TestSlowClient(t *testing.T) {
+	ws, err := New(func(c Configurator) error {
+		return c.Endpoint("localhost:8080")
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	// the slow client never reads, so its socket is filled until the writes are blocked
+	connect(t, ws, "/")
+	client := connect(t, ws, "/")
+
+	message, err := websocketconnections.NewMessage(websocketconnections.Status, strings.Repeat("x", 64<<10))
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	// each message is received by the other client before broadcasting the next one, although the slow client is blocked
+	for i := 0; i < 200; i++ {
+		ws.Broadcast(message)
+
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected the message %d received, got error '%v'", i, err)
+		}
+	}
+
+	// the slow client is disconnected when its queue is full
+	deadline := time.Now().Add(2 * time.Second)
+	for ws.Count() > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if ws.Count() != 1 {
+		t.Errorf("expected the slow client removed, got %d connections", ws.Count())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ws, err := New(func(c Configurator) error {
+		return c.Endpoint("localhost:8080")
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	client := connect(t, ws, "/")
+
+	ws.Shutdown()
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going away close frame, got '%v'", err)
+	}
+}
+
+func TestConcurrentConnections(t *testing.T) {
+	ws, err := New(func(c Configurator) error {
+		return c.Endpoint("localhost:8080")
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(ws.WebsocketHandler))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Origin", "http://localhost")
+	address := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	stop := make(chan struct{})
+	reloads := sync.WaitGroup{}
+	reloads.Add(1)
+	go func() {
+		defer reloads.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				err := ws.Reload()
+				if err != nil {
+					t.Errorf("expected error nil, got '%v'", err)
+				}
+			}
+		}
+	}()
+
+	clients := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			for j := 0; j < 10; j++ {
+				client, _, err := websocket.DefaultDialer.Dial(address, header)
+				if err != nil {
+					t.Errorf("failed to dial the websocket server: %v", err)
+					return
+				}
+				client.Close()
+			}
+		}()
+	}
+
+	clients.Wait()
+	close(stop)
+	reloads.Wait()
+
+	// waits the handlers detect the clients disconnected
+	deadline := time.Now().Add(2 * time.Second)
+	for ws.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if ws.Count() != 0 {
+		t.Errorf("expected all connections removed, got %d", ws.Count())
+	}
+}
+
+func TestTargetedReload(t *testing.T) {
+	ws, err := New(func(c Configurator) error {
+		return c.Endpoint("localhost:8080")
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	a := connect(t, ws, "/example.com/a/pkg")
+	b := connect(t, ws, "/example.com/b")
+
+	response := httptest.NewRecorder()
+	ws.ReloadHandler(response, httptest.NewRequest(http.MethodGet, "/reload?module=example.com/a", nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, response.Code)
+	}
+
+	message := websocketconnections.Message{}
+	a.SetReadDeadline(time.Now().Add(time.Second))
+	err = a.ReadJSON(&message)
+	if err != nil || message.Type != websocketconnections.Reload {
+		t.Errorf("expected the reload message, got %+v and error '%v'", message, err)
+	}
+
+	b.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, data, err := b.ReadMessage()
+	if err == nil {
+		t.Errorf("expected the other module not reloaded, got %s", data)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ws, err := New(func(c Configurator) error {
+		return c.Endpoint("localhost:8080")
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(ws.EventsHandler))
+	defer server.Close()
+
+	// the websocket and event stream connections are stored together
+	connect(t, ws, "/example.com/a")
+
+	response, err := http.Get(server.URL + "?page=/example.com/b")
+	if err != nil {
+		t.Fatalf("failed to request the event stream: %v", err)
+	}
+	defer response.Body.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for ws.Count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if ws.Count() != 2 {
+		t.Fatalf("expected 2 connections, got %d", ws.Count())
+	}
+
+	err = ws.Notify(websocketconnections.Status, "building", "/example.com/b")
+	if err != nil {
+		t.Fatalf("expected error nil, got '%v'", err)
+	}
+
+	reader := bufio.NewReader(response.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected the status event, got error '%v'", err)
+		}
+
+		if strings.HasPrefix(line, "data: ") {
+			expected := `data: {"version":1,"type":"status","text":"building"}`
+			if strings.TrimSpace(line) != expected {
+				t.Errorf("expected %s, got %s", expected, line)
+			}
+			break
+		}
+	}
+
+	ws.Shutdown()
+
+	deadline = time.Now().Add(time.Second)
+	for ws.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if ws.Count() != 0 {
+		t.Errorf("expected all connections removed, got %d", ws.Count())
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	ws, err := New(func(c Configurator) error {
+		err := c.Endpoint("localhost:8080")
+		if err != nil {
+			return err
+		}
+		err = c.PingInterval(20 * time.Millisecond)
+		if err != nil {
+			return err
+		}
+		return c.PongWait(100 * time.Millisecond)
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	// the alive peer answers the pings while it reads, as the browsers do
+	alive := connect(t, ws, "/example.com/a")
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// the dead peer reads the pings but never answers them, as a half-open connection
+	dead := connect(t, ws, "/example.com/b")
+	pings := make(chan struct{}, 1)
+	dead.SetPingHandler(func(string) error {
+		select {
+		case pings <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go func() {
+		for {
+			if _, _, err := dead.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-pings:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the server pings the clients")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for ws.Count() > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// waits some pong deadlines more to check that the alive peer is kept
+	time.Sleep(300 * time.Millisecond)
+
+	if ws.Count() != 1 {
+		t.Errorf("expected only the alive connection kept, got %d connections", ws.Count())
+	}
+}
+
+func TestOrigins(t *testing.T) {
+
+	t.Run("wrong pattern", func(t *testing.T) {
+		_, err := New(func(c Configurator) error {
+			return c.Origins("http://localhost/page")
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+
+	ws, err := New(func(c Configurator) error {
+		err := c.Endpoint("localhost:8080")
+		if err != nil {
+			return err
+		}
+		return c.Origins("https://*.example.com")
+	})
+	if err != nil {
+		t.Fatalf("failed to instance the websocket server: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(ws.WebsocketHandler))
+	defer server.Close()
+
+	address := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	cases := map[string]struct {
+		origin   string
+		expected bool
+	}{
+		"allowed":  {"https://docs.example.com", true},
+		"rejected": {"http://localhost", false},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Origin", tc.origin)
+
+			client, _, err := websocket.DefaultDialer.Dial(address, header)
+			if client != nil {
+				client.Close()
+			}
+
+			if (err == nil) != tc.expected {
+				t.Errorf("expected the connection accepted %v, got error '%v'", tc.expected, err)
+			}
+		})
+	}
+	t.Run("public", func(t *testing.T) {
+		ws, err := New(func(c Configurator) error {
+			err := c.Endpoint("localhost:8080")
+			if err != nil {
+				return err
+			}
+			err = c.Public("https://docs.example.com")
+			if err != nil {
+				return err
+			}
+			return c.Origins(websocketconnections.Public)
+		})
+		if err != nil {
+			t.Fatalf("failed to instance the websocket server: %v", err)
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(ws.WebsocketHandler))
+		defer server.Close()
+
+		address := "ws" + strings.TrimPrefix(server.URL, "http")
+
+		for origin, expected := range map[string]bool{"https://docs.example.com": true, "http://docs.example.com": false} {
+			header := http.Header{}
+			header.Set("Origin", origin)
+
+			client, _, err := websocket.DefaultDialer.Dial(address, header)
+			if client != nil {
+				client.Close()
+			}
+
+			if (err == nil) != expected {
+				t.Errorf("expected the connection of %s accepted %v, got error '%v'", origin, expected, err)
+			}
+		}
+	})
+
+	t.Run("wrong public", func(t *testing.T) {
+		_, err := New(func(c Configurator) error {
+			return c.Public("localhost:8080")
+		})
+		if err == nil {
+			t.Errorf("expected an error, got error nil")
+		}
+	})
+}